@@ -0,0 +1,72 @@
+package mysqlutils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BuildSelect returns the query and arguments Select would run for the same
+// arguments, without touching the database.
+func BuildSelect(tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []interface{}, error) {
+	return buildSelect(tableName, columns, whereClause, newOptions(opts))
+}
+
+// BuildInsert returns the statement and arguments Insert would run for data.
+// It returns an empty statement when data is empty.
+func BuildInsert(tableName string, data []map[string]interface{}) (string, []interface{}, error) {
+	if len(data) == 0 {
+		return "", nil, nil
+	}
+	query, _, args, err := buildInsert("INSERT INTO", tableName, data)
+	return query, args, err
+}
+
+// BuildUpdate returns the statement and arguments Update would run. Like
+// Update it returns ErrNoWhere when where holds no conditions.
+func BuildUpdate(table string, data map[string]interface{}, where interface{}) (string, []interface{}, error) {
+	return buildUpdate(table, data, where, false)
+}
+
+// BuildDelete returns the statement and arguments Delete would run.
+func BuildDelete(table string, conditions interface{}) (string, []interface{}, error) {
+	return buildDelete(table, conditions)
+}
+
+// RawExpr is an SQL expression used as a value in Update data, as in
+// map[string]interface{}{"views": Raw("views + 1")}. Build one with Raw.
+type RawExpr struct {
+	expr string
+	args []interface{}
+}
+
+// Raw returns expr for use as an Update value, written into the statement as
+// is, with args bound to any ? placeholders in it. Pass user input only
+// through args. As a safeguard, expressions containing quotes, backticks,
+// semicolons or comments are rejected; for a plain counter use Incr.
+func Raw(expr string, args ...interface{}) RawExpr {
+	return RawExpr{expr: expr, args: args}
+}
+
+// check rejects expressions that could end the value early and inject SQL.
+func (r RawExpr) check() error {
+	if strings.TrimSpace(r.expr) == "" || strings.ContainsAny(r.expr, "'\"`;#\\") ||
+		strings.Contains(r.expr, "--") || strings.Contains(r.expr, "/*") {
+		return fmt.Errorf("mysqlutils: unsafe raw expression %q", r.expr)
+	}
+	if n := strings.Count(r.expr, "?"); n != len(r.args) {
+		return fmt.Errorf("mysqlutils: raw expression %q has %d placeholders for %d args", r.expr, n, len(r.args))
+	}
+	return nil
+}
+
+// increment is the type of the values returned by Incr.
+type increment struct {
+	delta interface{}
+}
+
+// Incr is an Update value that adds delta to the column's current value
+// atomically, as in map[string]interface{}{"views": Incr(1)}, which renders
+// as views = views + ?. Use a negative delta to decrement.
+func Incr(delta interface{}) interface{} {
+	return increment{delta: delta}
+}
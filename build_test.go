@@ -0,0 +1,75 @@
+package mysqlutils
+
+import "testing"
+
+func TestBuildSelectNoColumns(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		columns []string
+	}{
+		{"nil", nil},
+		{"empty", []string{}},
+	} {
+		query, args, err := BuildSelect("users", tt.columns, nil)
+		if err != nil {
+			t.Fatalf("%s columns: %v", tt.name, err)
+		}
+		if want := "SELECT * FROM `users`"; query != want {
+			t.Errorf("%s columns: query = %q, want %q", tt.name, query, want)
+		}
+		if len(args) != 0 {
+			t.Errorf("%s columns: args = %v, want none", tt.name, args)
+		}
+	}
+}
+
+func TestBuildSelectStar(t *testing.T) {
+	tests := []struct {
+		columns []string
+		want    string
+	}{
+		{[]string{"*"}, "SELECT * FROM `users`"},
+		{[]string{"users.*"}, "SELECT `users`.* FROM `users`"},
+	}
+	for _, tt := range tests {
+		query, _, err := BuildSelect("users", tt.columns, nil)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.columns, err)
+		}
+		if query != tt.want {
+			t.Errorf("%v: query = %q, want %q", tt.columns, query, tt.want)
+		}
+	}
+}
+
+func TestBuildSelectSchemaQualified(t *testing.T) {
+	query, args, err := BuildSelect("analytics.events", []string{"id", "events.name"}, map[string]interface{}{"analytics.events.id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT `id`, `events`.`name` FROM `analytics`.`events` WHERE `analytics`.`events`.`id` = ?"
+	if query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+	if len(args) != 1 || args[0] != 1 {
+		t.Errorf("args = %v, want [1]", args)
+	}
+}
+
+func TestThreePartNamesOnlyForColumnReferences(t *testing.T) {
+	if _, _, err := BuildSelect("a.b.c", nil, nil); err == nil {
+		t.Error("BuildSelect accepted a three-part table name")
+	}
+	if _, _, err := BuildInsert("events", []map[string]interface{}{{"a.b.c": 1}}); err == nil {
+		t.Error("BuildInsert accepted a three-part column name")
+	}
+	if _, _, err := BuildUpdate("events", map[string]interface{}{"a.b.c": 1}, map[string]interface{}{"id": 1}); err == nil {
+		t.Error("BuildUpdate accepted a three-part SET column")
+	}
+	if _, _, err := BuildSelect("events", nil, nil, OrderBy("a.b.c", "ASC")); err == nil {
+		t.Error("BuildSelect accepted a three-part ORDER BY column")
+	}
+	if _, _, err := BuildSelect("events", []string{"day"}, nil, GroupBy("a.b.c")); err == nil {
+		t.Error("BuildSelect accepted a three-part GROUP BY column")
+	}
+}
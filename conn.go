@@ -0,0 +1,200 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	defaultMu sync.RWMutex
+	defaultDB *sql.DB
+)
+
+// SetDefaultDB registers db as the connection used by every function that is
+// passed a nil connection. It is safe to call from multiple goroutines, and
+// passing nil removes the default. Functions resolve the default when they are
+// called, so changing it does not affect calls already in progress.
+func SetDefaultDB(db *sql.DB) {
+	defaultMu.Lock()
+	defaultDB = db
+	defaultMu.Unlock()
+}
+
+// DefaultDB returns the connection registered with SetDefaultDB, or nil.
+func DefaultDB() *sql.DB {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultDB
+}
+
+// resolveDB returns db, or the default connection when db is nil (including
+// a nil *sql.DB).
+func resolveDB(db Querier) (Querier, error) {
+	if db != nil {
+		if d, ok := db.(*sql.DB); !ok || d != nil {
+			return db, nil
+		}
+	}
+	if d := DefaultDB(); d != nil {
+		return d, nil
+	}
+	return nil, ErrNoDB
+}
+
+// ConnectOption configures the connection pool opened by Connect.
+type ConnectOption func(*sql.DB)
+
+// MaxOpenConns limits the number of open connections; see sql.DB.SetMaxOpenConns.
+func MaxOpenConns(n int) ConnectOption {
+	return func(db *sql.DB) {
+		db.SetMaxOpenConns(n)
+	}
+}
+
+// MaxIdleConns limits the number of idle connections; see sql.DB.SetMaxIdleConns.
+func MaxIdleConns(n int) ConnectOption {
+	return func(db *sql.DB) {
+		db.SetMaxIdleConns(n)
+	}
+}
+
+// ConnMaxLifetime limits how long a connection may be reused; see
+// sql.DB.SetConnMaxLifetime.
+func ConnMaxLifetime(d time.Duration) ConnectOption {
+	return func(db *sql.DB) {
+		db.SetConnMaxLifetime(d)
+	}
+}
+
+// ConnMaxIdleTime limits how long a connection may sit idle; see
+// sql.DB.SetConnMaxIdleTime.
+func ConnMaxIdleTime(d time.Duration) ConnectOption {
+	return func(db *sql.DB) {
+		db.SetConnMaxIdleTime(d)
+	}
+}
+
+// Connect opens a MySQL connection pool for dsn, applies opts and pings the
+// server to make sure it is reachable. The pool is closed again if the ping
+// fails.
+func Connect(dsn string, opts ...ConnectOption) (*sql.DB, error) {
+	return ConnectContext(context.Background(), dsn, opts...)
+}
+
+// ConnectContext is like Connect but pings the server with the given context.
+func ConnectContext(ctx context.Context, dsn string, opts ...ConnectOption) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Stats returns the connection pool statistics of db, such as open, in-use
+// and idle connections and how often callers waited for one. A nil db uses
+// the default connection; with no default the zero value is returned.
+func Stats(db *sql.DB) sql.DBStats {
+	if db == nil {
+		db = DefaultDB()
+		if db == nil {
+			return sql.DBStats{}
+		}
+	}
+	return db.Stats()
+}
+
+// WatchStats calls fn with the pool statistics of db every interval, from a
+// new goroutine, until ctx is done. It is meant for logging or exporting
+// metrics while tuning the pool size.
+func WatchStats(ctx context.Context, db *sql.DB, interval time.Duration, fn func(sql.DBStats)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(Stats(db))
+			}
+		}
+	}()
+}
+
+// HealthCheck verifies that db can serve queries: it pings the server and then
+// runs SELECT 1, which catches connections that are pooled but unusable. It is
+// suitable for readiness and liveness probes; the returned error says which
+// step failed.
+func HealthCheck(ctx context.Context, db *sql.DB) error {
+	if db == nil {
+		db = DefaultDB()
+		if db == nil {
+			return ErrNoDB
+		}
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("mysqlutils: health check: ping: %w", err)
+	}
+
+	var one int
+	if err := queryRowScan(ctx, db, "SELECT 1", nil, &one); err != nil {
+		return fmt.Errorf("mysqlutils: health check: SELECT 1: %w", err)
+	}
+	return nil
+}
+
+// DSN describes a MySQL connection and renders it as a go-sql-driver/mysql
+// data source name for Connect or sql.Open.
+type DSN struct {
+	User     string
+	Password string
+	// Host defaults to 127.0.0.1 and Port to 3306.
+	Host string
+	Port int
+	// Database is the default database; it may be empty.
+	Database string
+	// Params holds driver parameters such as tls, timeout or loc, and
+	// session variables. parseTime=true and charset=utf8mb4 are added
+	// unless Params sets them.
+	Params map[string]string
+}
+
+// String renders d as a DSN, escaping the parts that need it.
+func (d DSN) String() string {
+	cfg := mysql.NewConfig()
+	cfg.User = d.User
+	cfg.Passwd = d.Password
+	cfg.Net = "tcp"
+	host, port := d.Host, d.Port
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if port == 0 {
+		port = 3306
+	}
+	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	cfg.DBName = d.Database
+
+	cfg.Params = map[string]string{"parseTime": "true", "charset": "utf8mb4"}
+	for k, v := range d.Params {
+		cfg.Params[k] = v
+	}
+	return cfg.FormatDSN()
+}
@@ -0,0 +1,86 @@
+package mysqlutils
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// openTestDB returns a *sql.DB for the MySQL driver. sql.Open does not
+// connect, so no server is needed as long as no query runs.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("mysql", "user:password@tcp(127.0.0.1:3306)/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestDefaultDB(t *testing.T) {
+	t.Cleanup(func() { SetDefaultDB(nil) })
+
+	SetDefaultDB(nil)
+	if got := DefaultDB(); got != nil {
+		t.Fatalf("DefaultDB() = %v, want nil", got)
+	}
+
+	db := openTestDB(t)
+	SetDefaultDB(db)
+	if got := DefaultDB(); got != db {
+		t.Fatalf("DefaultDB() = %v, want the registered db", got)
+	}
+
+	SetDefaultDB(nil)
+	if got := DefaultDB(); got != nil {
+		t.Fatalf("DefaultDB() after SetDefaultDB(nil) = %v, want nil", got)
+	}
+}
+
+func TestResolveDB(t *testing.T) {
+	t.Cleanup(func() { SetDefaultDB(nil) })
+	def := openTestDB(t)
+	other := openTestDB(t)
+
+	SetDefaultDB(def)
+	tests := []struct {
+		name string
+		db   Querier
+		want Querier
+	}{
+		{"nil interface", nil, def},
+		{"nil *sql.DB", (*sql.DB)(nil), def},
+		{"explicit db", other, other},
+	}
+	for _, tt := range tests {
+		got, err := resolveDB(tt.db)
+		if err != nil {
+			t.Errorf("%s: resolveDB returned error %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: resolveDB returned the wrong connection", tt.name)
+		}
+	}
+}
+
+func TestNoDB(t *testing.T) {
+	SetDefaultDB(nil)
+
+	if _, err := resolveDB(nil); !errors.Is(err, ErrNoDB) {
+		t.Errorf("resolveDB(nil) error = %v, want ErrNoDB", err)
+	}
+	if _, err := resolveDB((*sql.DB)(nil)); !errors.Is(err, ErrNoDB) {
+		t.Errorf("resolveDB(nil *sql.DB) error = %v, want ErrNoDB", err)
+	}
+	if _, _, err := Select(nil, "users", nil, nil); !errors.Is(err, ErrNoDB) {
+		t.Errorf("Select error = %v, want ErrNoDB", err)
+	}
+	if _, _, _, err := Insert(nil, "users", []map[string]interface{}{{"name": "a"}}); !errors.Is(err, ErrNoDB) {
+		t.Errorf("Insert error = %v, want ErrNoDB", err)
+	}
+	if err := WithTransaction(nil, func(*sql.Tx) error { return nil }); !errors.Is(err, ErrNoDB) {
+		t.Errorf("WithTransaction error = %v, want ErrNoDB", err)
+	}
+}
@@ -0,0 +1,97 @@
+package mysqlutils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	// ErrNoRows is returned by SelectOne when no row matches.
+	ErrNoRows = errors.New("mysqlutils: no rows in result set")
+
+	// ErrTooManyRows is returned by SelectOne when more than one row matches.
+	ErrTooManyRows = errors.New("mysqlutils: more than one row in result set")
+
+	// ErrNoWhere is returned by Update when it is given no WHERE conditions.
+	// Use UpdateAll to deliberately update every row of a table.
+	ErrNoWhere = errors.New("mysqlutils: refusing to run UPDATE without WHERE")
+
+	// ErrNoDB is returned when a function is given a nil connection and no
+	// default connection has been registered with SetDefaultDB.
+	ErrNoDB = errors.New("mysqlutils: no database connection; pass one or call SetDefaultDB")
+
+	// ErrInvalidIdentifier is wrapped by the error returned when a table or
+	// column name is not safe to interpolate into a query.
+	ErrInvalidIdentifier = errors.New("mysqlutils: invalid identifier")
+
+	// ErrReadOnly is returned when a statement that may write is run on a
+	// connection wrapped with ReadOnly.
+	ErrReadOnly = errors.New("mysqlutils: write on read-only connection")
+)
+
+// queryError wraps an error from the driver with the operation and the query
+// that produced it. The driver error stays reachable through errors.Is and
+// errors.As.
+func queryError(op, query string, err error) error {
+	return fmt.Errorf("mysqlutils: %s %q: %w", op, query, err)
+}
+
+// MySQL server error numbers recognized by the Is* helpers.
+const (
+	errLockWaitTimeout = 1205
+	errDeadlock        = 1213
+	errDuplicateKey    = 1062
+	errRowIsReferenced = 1451
+	errNoReferencedRow = 1452
+)
+
+// AsMySQLError returns the *mysql.MySQLError wrapped in err, if any, giving
+// access to the server's error number, SQLSTATE and message. Errors returned
+// by this package wrap the driver's error, so they work here too.
+func AsMySQLError(err error) (*mysql.MySQLError, bool) {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr, true
+	}
+	return nil, false
+}
+
+// hasErrorNumber reports whether err wraps a MySQL error with one of numbers.
+func hasErrorNumber(err error, numbers ...uint16) bool {
+	myErr, ok := AsMySQLError(err)
+	if !ok {
+		return false
+	}
+	for _, n := range numbers {
+		if myErr.Number == n {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDuplicateKey reports whether err is a duplicate entry for a primary or
+// unique key (error 1062).
+func IsDuplicateKey(err error) bool {
+	return hasErrorNumber(err, errDuplicateKey)
+}
+
+// IsDeadlock reports whether err means the transaction was chosen as a
+// deadlock victim and rolled back (error 1213).
+func IsDeadlock(err error) bool {
+	return hasErrorNumber(err, errDeadlock)
+}
+
+// IsLockWaitTimeout reports whether err is a lock wait timeout (error 1205).
+func IsLockWaitTimeout(err error) bool {
+	return hasErrorNumber(err, errLockWaitTimeout)
+}
+
+// IsForeignKeyViolation reports whether err is a foreign key constraint
+// failure, either a child row without a parent (error 1452) or a parent row
+// that is still referenced (error 1451).
+func IsForeignKeyViolation(err error) bool {
+	return hasErrorNumber(err, errRowIsReferenced, errNoReferencedRow)
+}
@@ -0,0 +1,200 @@
+package mysqlutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SelectCSV runs the same query as Select and writes the result to w as CSV:
+// a header row of column names followed by one record per row, in column
+// order. NULL values are written as empty fields.
+func SelectCSV(db Querier, tableName string, columns []string, whereClause interface{}, w io.Writer, opts ...Option) error {
+	return SelectCSVContext(context.Background(), db, tableName, columns, whereClause, w, opts...)
+}
+
+// SelectCSVContext is like SelectCSV but runs the query with the given context.
+func SelectCSVContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, w io.Writer, opts ...Option) (err error) {
+	var count int64
+	defer func(start time.Time) { observe(OpSelect, start, count, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return err
+	}
+	o := newOptions(opts)
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	query, args, err := buildSelect(tableName, columns, whereClause, o)
+	if err != nil {
+		return err
+	}
+	if err := o.checkLock(db); err != nil {
+		return err
+	}
+
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return queryError("select", query, err)
+	}
+	defer rows.Close()
+
+	scanner, err := newRowScanner(rows, o)
+	if err != nil {
+		return queryError("select", query, err)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(scanner.columnNames); err != nil {
+		return err
+	}
+	record := make([]string, len(scanner.columnNames))
+	for rows.Next() {
+		row, err := scanner.scan()
+		if err != nil {
+			return queryError("select", query, err)
+		}
+		count++
+		for i, name := range scanner.columnNames {
+			record[i] = csvField(row[name])
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return queryError("select", query, err)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvField formats a scanned value as a CSV field.
+func csvField(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// SelectJSON runs the same query as Select and writes the result to w as a
+// JSON array with one object per row, keyed by column name in column order.
+// Values keep their MySQL types as with the NativeTypes option, so integers,
+// floats and DECIMALs are numbers, dates are RFC 3339 strings and NULL is
+// null. JSON columns are nested as they are stored rather than quoted as
+// strings. TINYINT(1) columns come out as 0 or 1, since the driver does not
+// report the display width needed to tell them apart from other TINYINTs.
+func SelectJSON(db Querier, tableName string, columns []string, whereClause interface{}, w io.Writer, opts ...Option) error {
+	return SelectJSONContext(context.Background(), db, tableName, columns, whereClause, w, opts...)
+}
+
+// SelectJSONContext is like SelectJSON but runs the query with the given
+// context.
+func SelectJSONContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, w io.Writer, opts ...Option) (err error) {
+	var count int64
+	defer func(start time.Time) { observe(OpSelect, start, count, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return err
+	}
+	o := newOptions(append(opts[:len(opts):len(opts)], NativeTypes()))
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	query, args, err := buildSelect(tableName, columns, whereClause, o)
+	if err != nil {
+		return err
+	}
+	if err := o.checkLock(db); err != nil {
+		return err
+	}
+
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return queryError("select", query, err)
+	}
+	defer rows.Close()
+
+	scanner, err := newRowScanner(rows, o)
+	if err != nil {
+		return queryError("select", query, err)
+	}
+
+	keys := make([][]byte, len(scanner.columnNames))
+	jsonColumns := make([]bool, len(scanner.columnNames))
+	for i, name := range scanner.columnNames {
+		if keys[i], err = json.Marshal(name); err != nil {
+			return err
+		}
+		jsonColumns[i] = scanner.columnTypes[i].DatabaseTypeName() == "JSON"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for n := 0; rows.Next(); n++ {
+		row, err := scanner.scan()
+		if err != nil {
+			return queryError("select", query, err)
+		}
+		count++
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('{')
+		for i, name := range scanner.columnNames {
+			v := row[name]
+			if jsonColumns[i] {
+				v = rawJSON(v)
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("mysqlutils: column %s: %w", name, err)
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(keys[i])
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+
+		// Write each row out as it is built rather than holding the
+		// whole result in memory.
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+	}
+	if err := rows.Err(); err != nil {
+		return queryError("select", query, err)
+	}
+
+	buf.WriteByte(']')
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// rawJSON returns the scanned value of a JSON column as a json.RawMessage, so
+// the document is nested in the output rather than quoted as a string.
+func rawJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return json.RawMessage(v)
+	case []byte:
+		return json.RawMessage(v)
+	default:
+		return v
+	}
+}
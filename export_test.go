@@ -0,0 +1,25 @@
+package mysqlutils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRawJSONNestsDocuments(t *testing.T) {
+	for _, tt := range []struct {
+		value interface{}
+		want  string
+	}{
+		{`{"a": [1, 2]}`, `{"a":[1,2]}`},
+		{[]byte(`"text"`), `"text"`},
+		{nil, `null`},
+	} {
+		got, err := json.Marshal(rawJSON(tt.value))
+		if err != nil {
+			t.Fatalf("%#v: %v", tt.value, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%#v: got %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Logger is called after every statement the package sends to the database,
+// with the query text, its arguments, how long the driver took and the
+// resulting error, if any. For queries the duration covers sending the query,
+// not reading the rows.
+type Logger func(query string, args []interface{}, duration time.Duration, err error)
+
+var (
+	loggerMu sync.RWMutex
+	logger   Logger
+)
+
+// SetLogger installs fn as the package-wide query logger; nil disables
+// logging. fn may be called from multiple goroutines at once.
+func SetLogger(fn Logger) {
+	loggerMu.Lock()
+	logger = fn
+	loggerMu.Unlock()
+}
+
+func currentLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// logQuery reports a finished statement to the installed Logger.
+func logQuery(query string, args []interface{}, start time.Time, err error) {
+	if fn := currentLogger(); fn != nil {
+		fn(query, args, time.Since(start), err)
+	}
+}
+
+// execContext runs a statement on db and logs it.
+func execContext(ctx context.Context, db Querier, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := db.ExecContext(ctx, query, args...)
+	logQuery(query, args, start, err)
+	return result, err
+}
+
+// stmtExecContext runs the prepared statement stmt, whose text is query, and
+// logs it.
+func stmtExecContext(ctx context.Context, stmt *sql.Stmt, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := stmt.ExecContext(ctx, args...)
+	logQuery(query, args, start, err)
+	return result, err
+}
+
+// queryContext runs a query on db and logs it.
+func queryContext(ctx context.Context, db Querier, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, query, args...)
+	logQuery(query, args, start, err)
+	return rows, err
+}
+
+// queryRowScan runs a query expected to return at most one row, scans it into
+// dest and logs it. Like sql.Row.Scan it returns sql.ErrNoRows when there is
+// no row.
+func queryRowScan(ctx context.Context, db Querier, query string, args []interface{}, dest ...interface{}) error {
+	start := time.Now()
+	err := db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	logQuery(query, args, start, err)
+	return err
+}
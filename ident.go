@@ -0,0 +1,167 @@
+package mysqlutils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// identPattern matches the names the package accepts: letters, digits and
+// underscores, optionally qualified by a schema or table name.
+var identPattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)?$`)
+
+// columnRefPattern is like identPattern but also accepts a column qualified
+// by both schema and table, as in analytics.events.id, which tells apart
+// same-named tables of different schemas. It is only used where such a
+// reference is valid SQL: SELECT lists, WHERE conditions and join columns.
+var columnRefPattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+){0,2}$`)
+
+// checkIdent returns an error wrapping ErrInvalidIdentifier for the first
+// name that does not match identPattern. Names cannot be passed as bound
+// parameters, so this is what keeps them from injecting SQL.
+func checkIdent(names ...string) error {
+	for _, name := range names {
+		if !identPattern.MatchString(name) {
+			return fmt.Errorf("%w %q", ErrInvalidIdentifier, name)
+		}
+	}
+	return nil
+}
+
+// checkColumnRef is like checkIdent but matches names against
+// columnRefPattern.
+func checkColumnRef(names ...string) error {
+	for _, name := range names {
+		if !columnRefPattern.MatchString(name) {
+			return fmt.Errorf("%w %q", ErrInvalidIdentifier, name)
+		}
+	}
+	return nil
+}
+
+// checkColumns is like checkIdent but also accepts *, table.*, aggregate
+// calls and aliased columns for a SELECT list.
+func checkColumns(columns []string) error {
+	for _, col := range columns {
+		if table, ok := starTable(col); ok {
+			if table != "" && !identPattern.MatchString(table) {
+				return fmt.Errorf("%w %q", ErrInvalidIdentifier, col)
+			}
+			continue
+		}
+		if expr, _, ok := splitAlias(col); ok {
+			col = expr
+		}
+		if _, err := columnExpr(col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aliasPattern matches a SELECT list entry renamed with AS, such as
+// "user_name AS name" or "COUNT(*) AS total".
+var aliasPattern = regexp.MustCompile(`^(?i)(.+?)\s+AS\s+([A-Za-z0-9_]+)$`)
+
+// splitAlias splits "expr AS alias" into its parts. ok is false when col has
+// no alias.
+func splitAlias(col string) (expr, alias string, ok bool) {
+	m := aliasPattern.FindStringSubmatch(strings.TrimSpace(col))
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// aggregatePattern matches the aggregate calls accepted in place of a column
+// name, such as COUNT(*), SUM(price) or COUNT(DISTINCT user_id).
+var aggregatePattern = regexp.MustCompile(`^(?i)(COUNT|SUM|AVG|MIN|MAX)\(\s*(DISTINCT\s+)?(\*|[A-Za-z0-9_]+(?:\.[A-Za-z0-9_]+){0,2})\s*\)$`)
+
+// columnExpr renders a column reference, or an aggregate call over one, with
+// the names quoted.
+func columnExpr(name string) (string, error) {
+	m := aggregatePattern.FindStringSubmatch(name)
+	if m == nil {
+		if err := checkColumnRef(name); err != nil {
+			return "", err
+		}
+		return quoteIdent(name), nil
+	}
+
+	fn, distinct, arg := strings.ToUpper(m[1]), m[2] != "", m[3]
+	if arg == "*" {
+		if fn != "COUNT" || distinct {
+			return "", fmt.Errorf("%w %q", ErrInvalidIdentifier, name)
+		}
+		return "COUNT(*)", nil
+	}
+	if distinct {
+		return fn + "(DISTINCT " + quoteIdent(arg) + ")", nil
+	}
+	return fn + "(" + quoteIdent(arg) + ")", nil
+}
+
+// isAggregate reports whether name is an aggregate call rather than a column.
+func isAggregate(name string) bool {
+	return aggregatePattern.MatchString(name)
+}
+
+// quoteIdent quotes a table or column name with backticks, doubling any
+// embedded backticks. A dotted name such as schema.table has each part quoted
+// separately, so "analytics.events" renders as `analytics`.`events`.
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = quoteName(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteName quotes name as a single identifier, dots included. It is used for
+// column aliases.
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// starTable reports whether col selects every column, either as * or as
+// table.*, and returns the table name for the latter.
+func starTable(col string) (string, bool) {
+	if col == "*" {
+		return "", true
+	}
+	if table, ok := strings.CutSuffix(col, ".*"); ok {
+		return table, true
+	}
+	return "", false
+}
+
+// quoteColumn renders an entry of a SELECT list, leaving * unquoted. Aggregate
+// calls are aliased to the expression as written, so the result is keyed by
+// "COUNT(*)" rather than MySQL's rendering of the quoted expression, unless
+// an alias is given with AS. It assumes name has passed checkColumns.
+func quoteColumn(name string) string {
+	if table, ok := starTable(name); ok {
+		if table == "" {
+			return "*"
+		}
+		return quoteIdent(table) + ".*"
+	}
+	if col, alias, ok := splitAlias(name); ok {
+		expr, _ := columnExpr(col)
+		return expr + " AS " + quoteName(alias)
+	}
+	expr, _ := columnExpr(name)
+	if isAggregate(name) {
+		expr += " AS " + quoteName(name)
+	}
+	return expr
+}
+
+// quoteIdents quotes each name with quoteIdent.
+func quoteIdents(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return quoted
+}
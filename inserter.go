@@ -0,0 +1,162 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxPlaceholders is the most parameters MySQL accepts in one prepared
+// statement.
+const maxPlaceholders = 65535
+
+// rowsPerStatement returns batchSize, lowered if needed so a statement of
+// that many rows, with perRow placeholders each, stays within
+// maxPlaceholders. It never returns less than one row.
+func rowsPerStatement(batchSize, perRow int) int {
+	if perRow > 0 && batchSize*perRow > maxPlaceholders {
+		batchSize = maxPlaceholders / perRow
+	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return batchSize
+}
+
+// Inserter inserts rows into one table through a reused prepared statement.
+// Rows added with Add are buffered and sent in batches, so a loop of inserts
+// costs one round trip per batch instead of one per row. If a batch fails,
+// its rows are dropped and the Inserter stops: Add, Flush and Close all
+// return that first error from then on, since the rows that follow were meant
+// to go in after the failed ones. An Inserter is not safe for concurrent use.
+type Inserter struct {
+	ctx       context.Context
+	db        Querier
+	tableName string
+	columns   []string
+	batchSize int
+
+	stmt       *sql.Stmt
+	batchQuery string
+	pending    []interface{}
+	rows       int
+	affected   int64
+	err        error
+}
+
+// PrepareInsert returns an Inserter for columns of tableName. Call Close when
+// done to send any buffered rows and release the prepared statement.
+func PrepareInsert(db Querier, tableName string, columns []string) (*Inserter, error) {
+	return PrepareInsertContext(context.Background(), db, tableName, columns)
+}
+
+// PrepareInsertContext is like PrepareInsert but runs every statement of the
+// Inserter with the given context.
+func PrepareInsertContext(ctx context.Context, db Querier, tableName string, columns []string) (*Inserter, error) {
+	db, err := resolveDB(db)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("mysqlutils: insert into %s needs at least one column", tableName)
+	}
+	if err := checkIdent(tableName); err != nil {
+		return nil, err
+	}
+	if err := checkIdent(columns...); err != nil {
+		return nil, err
+	}
+
+	batchSize := rowsPerStatement(DefaultBatchSize, len(columns))
+
+	ins := &Inserter{
+		ctx:       ctx,
+		db:        db,
+		tableName: tableName,
+		columns:   append([]string(nil), columns...),
+		batchSize: batchSize,
+	}
+
+	ins.batchQuery = ins.query(batchSize)
+	ins.stmt, err = db.PrepareContext(ctx, ins.batchQuery)
+	if err != nil {
+		return nil, queryError("prepare insert", ins.batchQuery, err)
+	}
+	return ins, nil
+}
+
+// Add buffers one row whose values are in the order of the Inserter's
+// columns, sending the batch once it is full.
+func (ins *Inserter) Add(values ...interface{}) error {
+	if len(values) != len(ins.columns) {
+		return fmt.Errorf("mysqlutils: insert into %s: got %d values for %d columns", ins.tableName, len(values), len(ins.columns))
+	}
+	if ins.err != nil {
+		return ins.err
+	}
+
+	ins.pending = append(ins.pending, values...)
+	ins.rows++
+	if ins.rows < ins.batchSize {
+		return nil
+	}
+
+	start := time.Now()
+	result, err := stmtExecContext(ins.ctx, ins.stmt, ins.batchQuery, ins.pending...)
+	return ins.done(start, ins.batchQuery, result, err)
+}
+
+// Flush sends the buffered rows, if any.
+func (ins *Inserter) Flush() error {
+	if ins.err != nil || ins.rows == 0 {
+		return ins.err
+	}
+
+	// A partial batch does not match the prepared statement's shape, so it
+	// goes out as a one-off statement.
+	query := ins.query(ins.rows)
+	start := time.Now()
+	result, err := execContext(ins.ctx, ins.db, query, ins.pending...)
+	return ins.done(start, query, result, err)
+}
+
+// RowsAffected returns the number of rows inserted by the batches sent so far.
+func (ins *Inserter) RowsAffected() int64 {
+	return ins.affected
+}
+
+// Close flushes the buffered rows and releases the prepared statement.
+func (ins *Inserter) Close() error {
+	err := ins.Flush()
+	if cerr := ins.stmt.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// done records the outcome of sending the batch query, begun at start, and
+// empties the buffer whether or not the batch succeeded. On failure the error
+// is kept so every later call reports it.
+func (ins *Inserter) done(start time.Time, query string, result sql.Result, err error) error {
+	ins.pending = ins.pending[:0]
+	ins.rows = 0
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	if err != nil {
+		ins.err = queryError("insert", query, err)
+	}
+	ins.affected += affected
+	observe(OpInsert, start, affected, ins.err)
+	return ins.err
+}
+
+// query renders the INSERT statement for n rows.
+func (ins *Inserter) query(n int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(ins.columns)), ", ") + ")"
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES", quoteIdent(ins.tableName), strings.Join(quoteIdents(ins.columns), ", ")) +
+		strings.TrimSuffix(strings.Repeat(row+", ", n), ", ")
+}
@@ -0,0 +1,119 @@
+package mysqlutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// LoadDataOptions describes the input format for LoadData. The zero value
+// reads comma-separated fields, optionally enclosed in double quotes, one row
+// per line.
+type LoadDataOptions struct {
+	// Columns lists the table columns the fields map to, in input order.
+	// When empty, the fields must cover every column in table order.
+	Columns []string
+	// FieldsTerminatedBy separates fields; it defaults to ",".
+	FieldsTerminatedBy string
+	// EnclosedBy is the quote character fields may be enclosed in; it
+	// defaults to a double quote. Set NoEnclosure to read fields as is.
+	EnclosedBy  string
+	NoEnclosure bool
+	// LinesTerminatedBy separates rows; it defaults to "\n".
+	LinesTerminatedBy string
+	// SkipHeader ignores the first line of the input.
+	SkipHeader bool
+}
+
+// loadDataSeq numbers the reader handlers registered by LoadData so
+// concurrent loads do not collide.
+var loadDataSeq atomic.Uint64
+
+// LoadData bulk loads rows read from r into table with LOAD DATA LOCAL
+// INFILE, which is far faster than INSERT for large imports. opts may be nil
+// for the default CSV format. It returns the number of rows loaded. The
+// server must allow local infile (local_infile=ON); the driver's reader
+// handler is used, so allowAllFiles is not needed.
+func LoadData(db Querier, table string, r io.Reader, opts *LoadDataOptions) (int64, error) {
+	return LoadDataContext(context.Background(), db, table, r, opts)
+}
+
+// LoadDataContext is like LoadData but runs the statement with the given
+// context.
+func LoadDataContext(ctx context.Context, db Querier, table string, r io.Reader, opts *LoadDataOptions) (affected int64, err error) {
+	defer func(start time.Time) { observe(OpInsert, start, affected, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return 0, err
+	}
+	if opts == nil {
+		opts = &LoadDataOptions{}
+	}
+
+	name := fmt.Sprintf("mysqlutils-load-%d", loadDataSeq.Add(1))
+	query, err := buildLoadData(table, "Reader::"+name, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	mysql.RegisterReaderHandler(name, func() io.Reader { return r })
+	defer mysql.DeregisterReaderHandler(name)
+
+	result, err := execContext(ctx, db, query)
+	if err != nil {
+		return 0, queryError("load data", query, err)
+	}
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return 0, queryError("load data", query, err)
+	}
+	return affected, nil
+}
+
+// buildLoadData renders the LOAD DATA statement reading from file.
+func buildLoadData(table, file string, opts *LoadDataOptions) (string, error) {
+	if err := checkIdent(table); err != nil {
+		return "", err
+	}
+	if err := checkIdent(opts.Columns...); err != nil {
+		return "", err
+	}
+
+	fields, lines := opts.FieldsTerminatedBy, opts.LinesTerminatedBy
+	if fields == "" {
+		fields = ","
+	}
+	if lines == "" {
+		lines = "\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "LOAD DATA LOCAL INFILE %s INTO TABLE %s", quoteString(file), quoteIdent(table))
+	fmt.Fprintf(&b, " FIELDS TERMINATED BY %s", quoteString(fields))
+	if !opts.NoEnclosure {
+		enclosed := opts.EnclosedBy
+		if enclosed == "" {
+			enclosed = `"`
+		}
+		fmt.Fprintf(&b, " OPTIONALLY ENCLOSED BY %s", quoteString(enclosed))
+	}
+	fmt.Fprintf(&b, " LINES TERMINATED BY %s", quoteString(lines))
+	if opts.SkipHeader {
+		b.WriteString(" IGNORE 1 LINES")
+	}
+	if len(opts.Columns) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(quoteIdents(opts.Columns), ", "))
+	}
+	return b.String(), nil
+}
+
+// quoteString renders s as a single-quoted MySQL string literal, for the
+// places where the syntax does not allow a placeholder.
+func quoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "\x00", `\0`).Replace(s) + "'"
+}
@@ -0,0 +1,92 @@
+package mysqlutils
+
+import (
+	"sync"
+	"time"
+)
+
+// Operation identifies the kind of operation reported to a MetricsCollector.
+type Operation string
+
+// The operations reported to a MetricsCollector.
+const (
+	OpSelect Operation = "select"
+	OpInsert Operation = "insert"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+
+	// OpQuery and OpExec report arbitrary SQL run with Query, Exec and the
+	// other functions that take query text.
+	OpQuery Operation = "query"
+	OpExec  Operation = "exec"
+)
+
+// MetricsCollector receives a report of each operation the package runs, for
+// feeding counters and latency histograms such as Prometheus ones without the
+// package depending on a metrics library. The operations reported are:
+//
+//   - OpSelect: Select and the functions built on it, SelectEach,
+//     SelectBatches, SelectRows (reported on Close), SelectInto, SelectCSV,
+//     SelectJSON, Count and Exists
+//   - OpInsert: Insert, Replace, InsertIgnore, InsertBatch, InsertSelect,
+//     InsertStructs, Upsert, UpsertBatch, LoadData and each batch an Inserter
+//     sends
+//   - OpUpdate: Update, UpdateAll, BatchUpdate and SoftDelete
+//   - OpDelete: Delete, DeleteN, DeleteByIDs, DeleteJoin, DeleteAll and
+//     Truncate
+//   - OpQuery and OpExec: Query, Scalar, Exec, ExecScript, CallProcedure and
+//     the functions built on them, such as QueryNamed and Explain
+//
+// Schema helpers such as Columns and EnsureTable and the savepoint functions
+// are not reported. Statements skipped by DryRun are not reported either. A
+// call that runs several statements, such as InsertBatch, is reported once,
+// and one built on another, such as Paginate, reports what it runs.
+type MetricsCollector interface {
+	// ObserveOperation is called after each operation with the number of
+	// rows it returned, for selects, or affected, for writes, and how long
+	// the whole call took. err is nil when the operation succeeded.
+	ObserveOperation(op Operation, rows int64, duration time.Duration, err error)
+}
+
+// nopMetrics is the MetricsCollector in use until SetMetricsCollector is
+// called.
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveOperation(Operation, int64, time.Duration, error) {}
+
+var (
+	metricsMu sync.RWMutex
+	metrics   MetricsCollector = nopMetrics{}
+)
+
+// SetMetricsCollector installs c as the package-wide MetricsCollector; nil
+// restores the default, which discards every report. c may be called from
+// multiple goroutines at once.
+func SetMetricsCollector(c MetricsCollector) {
+	if c == nil {
+		c = nopMetrics{}
+	}
+	metricsMu.Lock()
+	metrics = c
+	metricsMu.Unlock()
+}
+
+func currentMetrics() MetricsCollector {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	return metrics
+}
+
+// observe reports an operation that started at start to the installed
+// MetricsCollector.
+func observe(op Operation, start time.Time, rows int64, err error) {
+	currentMetrics().ObserveOperation(op, rows, time.Since(start), err)
+}
+
+// observe is like the package-level observe, except that nothing is reported
+// under DryRun since no statement ran.
+func (o *options) observe(op Operation, start time.Time, rows int64, err error) {
+	if o.dryRun == nil {
+		observe(op, start, rows, err)
+	}
+}
@@ -0,0 +1,60 @@
+package mysqlutils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// recordingMetrics collects the operations reported to it.
+type recordingMetrics struct {
+	ops  []Operation
+	errs []error
+}
+
+func (m *recordingMetrics) ObserveOperation(op Operation, rows int64, duration time.Duration, err error) {
+	m.ops = append(m.ops, op)
+	m.errs = append(m.errs, err)
+}
+
+func TestMetricsReportsFailures(t *testing.T) {
+	m := &recordingMetrics{}
+	SetMetricsCollector(m)
+	t.Cleanup(func() { SetMetricsCollector(nil) })
+	SetDefaultDB(nil)
+
+	Select(nil, "users", nil, nil)
+	SelectEach(nil, "users", nil, nil, func(map[string]interface{}) error { return nil })
+	SelectInto[struct{ ID int }](nil, "users", nil)
+	Insert(nil, "users", []map[string]interface{}{{"id": 1}})
+	Update(nil, "users", map[string]interface{}{"a": 1}, map[string]interface{}{"id": 1})
+	Truncate(nil, "users")
+	Query(nil, "SELECT 1")
+	Exec(nil, "DO 1")
+
+	want := []Operation{OpSelect, OpSelect, OpSelect, OpInsert, OpUpdate, OpDelete, OpQuery, OpExec}
+	if len(m.ops) != len(want) {
+		t.Fatalf("got reports %v, want %v", m.ops, want)
+	}
+	for i, op := range want {
+		if m.ops[i] != op {
+			t.Errorf("report %d: op = %s, want %s", i, m.ops[i], op)
+		}
+		if !errors.Is(m.errs[i], ErrNoDB) {
+			t.Errorf("report %d: err = %v, want ErrNoDB", i, m.errs[i])
+		}
+	}
+}
+
+func TestMetricsSkipsDryRun(t *testing.T) {
+	m := &recordingMetrics{}
+	SetMetricsCollector(m)
+	t.Cleanup(func() { SetMetricsCollector(nil) })
+
+	dry := DryRun(func(string, []interface{}) {})
+	Insert(nil, "users", []map[string]interface{}{{"id": 1}}, dry)
+	DeleteN(nil, "users", map[string]interface{}{"id": 1}, dry)
+	if len(m.ops) != 0 {
+		t.Errorf("got reports %v under DryRun, want none", m.ops)
+	}
+}
@@ -0,0 +1,109 @@
+package mysqlutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// QueryNamed is like Query but takes :name placeholders bound from params,
+// as in
+//
+//	QueryNamed(db, "SELECT * FROM orders WHERE user_id = :user AND total > :min",
+//		map[string]interface{}{"user": 7, "min": 100})
+//
+// A name may appear several times and is bound each time. Colons inside
+// quoted strings and identifiers, comments, and the := assignment operator
+// are left alone. A placeholder without a matching entry in params is an
+// error.
+func QueryNamed(db Querier, query string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	return QueryNamedContext(context.Background(), db, query, params)
+}
+
+// QueryNamedContext is like QueryNamed but runs the query with the given
+// context.
+func QueryNamedContext(ctx context.Context, db Querier, query string, params map[string]interface{}) ([]map[string]interface{}, error) {
+	positional, args, err := bindNamed(query, params)
+	if err != nil {
+		return nil, err
+	}
+	return QueryContext(ctx, db, positional, args...)
+}
+
+// ExecNamed is like Exec but takes :name placeholders as described on
+// QueryNamed.
+func ExecNamed(db Querier, query string, params map[string]interface{}) (int64, error) {
+	return ExecNamedContext(context.Background(), db, query, params)
+}
+
+// ExecNamedContext is like ExecNamed but runs the statement with the given
+// context.
+func ExecNamedContext(ctx context.Context, db Querier, query string, params map[string]interface{}) (int64, error) {
+	positional, args, err := bindNamed(query, params)
+	if err != nil {
+		return 0, err
+	}
+	return ExecContext(ctx, db, positional, args...)
+}
+
+// bindNamed rewrites the :name placeholders in query to ? and returns the
+// matching values from params in order.
+func bindNamed(query string, params map[string]interface{}) (string, []interface{}, error) {
+	var b strings.Builder
+	var args []interface{}
+
+	for i := 0; i < len(query); {
+		if end := skipLiteral(query, i); end > i {
+			b.WriteString(query[i:end])
+			i = end
+			continue
+		}
+		if query[i] == ':' && i+1 < len(query) && isNameStart(query[i+1]) {
+			end := i + 1
+			for end < len(query) && isNameChar(query[end]) {
+				end++
+			}
+			name := query[i+1 : end]
+			value, ok := params[name]
+			if !ok {
+				return "", nil, fmt.Errorf("mysqlutils: no value for named parameter :%s", name)
+			}
+			args = append(args, value)
+			b.WriteByte('?')
+			i = end
+			continue
+		}
+		b.WriteByte(query[i])
+		i++
+	}
+	return b.String(), args, nil
+}
+
+// skipLiteral returns the index just past the quoted text or comment starting
+// at query[i], or i when neither starts there. Executable /*! ... */ comments
+// hold SQL the server runs, so they are not skipped.
+func skipLiteral(query string, i int) int {
+	switch c := query[i]; {
+	case c == '\'' || c == '"' || c == '`':
+		return skipQuoted(query, i)
+	case isLineComment(query[i:]):
+		if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+			return i + end + 1
+		}
+		return len(query)
+	case strings.HasPrefix(query[i:], "/*") && !strings.HasPrefix(query[i:], "/*!"):
+		if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+			return i + end + 4
+		}
+		return len(query)
+	}
+	return i
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
@@ -0,0 +1,39 @@
+package mysqlutils
+
+import "testing"
+
+func TestBindNamedSkipsComments(t *testing.T) {
+	params := map[string]interface{}{"id": 7}
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM t -- by :user\nWHERE id = :id", "SELECT * FROM t -- by :user\nWHERE id = ?"},
+		{"SELECT * FROM t # by :user\nWHERE id = :id", "SELECT * FROM t # by :user\nWHERE id = ?"},
+		{"SELECT * FROM t /* by :user */ WHERE id = :id", "SELECT * FROM t /* by :user */ WHERE id = ?"},
+		{"SELECT * FROM t WHERE id = :id -- by :user", "SELECT * FROM t WHERE id = ? -- by :user"},
+		{"SELECT ':user', `:user` FROM t WHERE id = :id", "SELECT ':user', `:user` FROM t WHERE id = ?"},
+	} {
+		got, args, err := bindNamed(tt.query, params)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.query, got, tt.want)
+		}
+		if len(args) != 1 || args[0] != 7 {
+			t.Errorf("%q: args = %v, want [7]", tt.query, args)
+		}
+	}
+}
+
+func TestBindNamedExecutableComment(t *testing.T) {
+	got, args, err := bindNamed("SELECT /*!50000 :id */", map[string]interface{}{"id": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT /*!50000 ? */"; got != want || len(args) != 1 {
+		t.Errorf("got %q with %d args, want %q with 1", got, len(args), want)
+	}
+}
@@ -0,0 +1,584 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Option configures a single call to one of the query functions.
+type Option func(*options)
+
+type options struct {
+	orderBy []orderTerm
+	limit   int
+	offset  int
+	joins   []joinClause
+	groupBy []string
+	having  []interface{}
+
+	distinct   bool
+	rawColumns []string
+	batchKey   string
+	lock       string
+
+	excludeDeleted []string
+
+	createdAt string
+	updatedAt string
+
+	jsonColumns []string
+	omitZero    bool
+
+	dryRun    func(query string, args []interface{})
+	timeout   time.Duration
+	stmtCache *StmtCache
+
+	upsertIf []Cond
+
+	nativeTypes   bool
+	boolColumns   map[string]bool
+	binaryBytes   bool
+	lowerKeys     bool
+	decimalParser func(string) (interface{}, error)
+}
+
+type orderTerm struct {
+	column    string
+	direction string
+}
+
+type joinClause struct {
+	kind  string
+	table string
+	left  string
+	right string
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// OrderBy appends column to the ORDER BY clause of a Select. direction is
+// "ASC" or "DESC" (case-insensitive); an empty direction means ASC. Calling
+// OrderBy several times sorts by each column in the order given.
+func OrderBy(column, direction string) Option {
+	return func(o *options) {
+		o.orderBy = append(o.orderBy, orderTerm{column: column, direction: direction})
+	}
+}
+
+// Limit caps the number of rows returned by a Select. A limit of 0 means no
+// limit.
+func Limit(n int) Option {
+	return func(o *options) {
+		o.limit = n
+	}
+}
+
+// RawColumns appends exprs to the SELECT list exactly as written, for
+// computed columns such as "price * quantity AS total" that the column list
+// does not accept. The expressions are not validated or quoted, so never
+// build them from untrusted input. When the column list is empty, only the
+// raw expressions are selected.
+func RawColumns(exprs ...string) Option {
+	return func(o *options) {
+		o.rawColumns = append(o.rawColumns, exprs...)
+	}
+}
+
+// BatchKey makes SelectBatches page through rows by column, which must be
+// unique, such as the primary key, instead of by OFFSET. Each batch then
+// starts after the last key seen, so reading a large table stays linear
+// rather than rescanning the skipped rows for every page. Rows are returned
+// in column order and any OrderBy is ignored.
+func BatchKey(column string) Option {
+	return func(o *options) {
+		o.batchKey = column
+	}
+}
+
+// ForUpdate makes a Select lock the rows it reads with FOR UPDATE, so other
+// transactions can neither change nor lock them until this one ends. Locks
+// only last as long as a transaction, so the call must run on a *sql.Tx
+// (or a *sql.Conn with a transaction open); on a *sql.DB it fails.
+func ForUpdate() Option {
+	return func(o *options) {
+		o.lock = "FOR UPDATE"
+	}
+}
+
+// ForShare is like ForUpdate but takes shared locks with LOCK IN SHARE MODE,
+// which let other transactions read the rows but not change them.
+func ForShare() Option {
+	return func(o *options) {
+		o.lock = "LOCK IN SHARE MODE"
+	}
+}
+
+// checkLock rejects row locks on a connection pool, where the statement would
+// run in its own autocommit transaction and release the locks immediately.
+func (o *options) checkLock(db Querier) error {
+	if _, ok := db.(*sql.DB); ok && o.lock != "" {
+		return fmt.Errorf("mysqlutils: %s needs a transaction; pass a *sql.Tx", o.lock)
+	}
+	return nil
+}
+
+// Distinct makes a Select return only distinct rows, as SELECT DISTINCT.
+func Distinct() Option {
+	return func(o *options) {
+		o.distinct = true
+	}
+}
+
+// Offset skips the first n rows returned by a Select.
+func Offset(n int) Option {
+	return func(o *options) {
+		o.offset = n
+	}
+}
+
+// InnerJoin joins table into a Select, keeping rows where leftColumn equals
+// rightColumn. Both columns are usually qualified, as in
+// InnerJoin("orders", "users.id", "orders.user_id"). When a Select has joins,
+// each qualified column in the column list is returned under its qualified
+// name, such as "orders.id", so same-named columns of different tables do not
+// collide.
+func InnerJoin(table, leftColumn, rightColumn string) Option {
+	return join("INNER JOIN", table, leftColumn, rightColumn)
+}
+
+// LeftJoin is like InnerJoin but keeps rows of the left side that have no
+// match, with NULL for the joined table's columns.
+func LeftJoin(table, leftColumn, rightColumn string) Option {
+	return join("LEFT JOIN", table, leftColumn, rightColumn)
+}
+
+func join(kind, table, left, right string) Option {
+	return func(o *options) {
+		o.joins = append(o.joins, joinClause{kind: kind, table: table, left: left, right: right})
+	}
+}
+
+// joinClause renders the JOIN clauses in the order they were added.
+func (o *options) joinClause() (string, error) {
+	var b strings.Builder
+	for _, j := range o.joins {
+		if err := checkIdent(j.table); err != nil {
+			return "", fmt.Errorf("mysqlutils: %s: %w", j.kind, err)
+		}
+		if err := checkColumnRef(j.left, j.right); err != nil {
+			return "", fmt.Errorf("mysqlutils: %s: %w", j.kind, err)
+		}
+		fmt.Fprintf(&b, " %s %s ON %s = %s", j.kind, quoteIdent(j.table), quoteIdent(j.left), quoteIdent(j.right))
+	}
+	return b.String(), nil
+}
+
+// GroupBy groups the rows of a Select by columns. Aggregate calls such as
+// COUNT(*), SUM(price) or MAX(created_at) can then be used in the column list.
+func GroupBy(columns ...string) Option {
+	return func(o *options) {
+		o.groupBy = append(o.groupBy, columns...)
+	}
+}
+
+// Having filters the groups of a Select. conds accepts any WHERE form, and
+// its column names may be aggregate calls, as in Cond{"COUNT(*)", ">", 5}.
+func Having(conds interface{}) Option {
+	return func(o *options) {
+		o.having = append(o.having, conds)
+	}
+}
+
+// groupByClause renders the GROUP BY and HAVING clauses.
+func (o *options) groupByClause() (string, []interface{}, error) {
+	var clause string
+	if len(o.groupBy) > 0 {
+		if err := checkIdent(o.groupBy...); err != nil {
+			return "", nil, fmt.Errorf("mysqlutils: GROUP BY: %w", err)
+		}
+		clause = " GROUP BY " + strings.Join(quoteIdents(o.groupBy), ", ")
+	}
+
+	having, args, err := whereExpr(And(o.having...))
+	if err != nil {
+		return "", nil, fmt.Errorf("mysqlutils: HAVING: %w", err)
+	}
+	if having != "" {
+		clause += " HAVING " + having
+	}
+	return clause, args, nil
+}
+
+// ExcludeDeleted leaves rows marked by SoftDelete out of a Select by adding
+// column IS NULL to its WHERE conditions.
+func ExcludeDeleted(column string) Option {
+	return func(o *options) {
+		o.excludeDeleted = append(o.excludeDeleted, column)
+	}
+}
+
+// CreatedAt makes Insert, Replace and InsertBatch set column to the current
+// time in every row that does not already have it. UpdatedAt does the same
+// for Update and UpdateAll. The time comes from time.Now() in Go rather than
+// the database's NOW(), so all rows of a call share one value and it is bound
+// like any other argument; the driver converts it using the loc setting of the
+// DSN. The caller's maps are not modified.
+func CreatedAt(column string) Option {
+	return func(o *options) {
+		o.createdAt = column
+	}
+}
+
+// UpdatedAt makes Update and UpdateAll set column to the current time unless
+// data already sets it. See CreatedAt for how the time is chosen.
+func UpdatedAt(column string) Option {
+	return func(o *options) {
+		o.updatedAt = column
+	}
+}
+
+// stampCreated returns data with the CreatedAt column filled in, copying only
+// the rows it changes.
+func (o *options) stampCreated(data []map[string]interface{}) []map[string]interface{} {
+	if o.createdAt == "" {
+		return data
+	}
+
+	now := time.Now()
+	stamped := make([]map[string]interface{}, len(data))
+	for i, row := range data {
+		stamped[i] = withValue(row, o.createdAt, now)
+	}
+	return stamped
+}
+
+// stampUpdated returns data with the UpdatedAt column filled in.
+func (o *options) stampUpdated(data map[string]interface{}) map[string]interface{} {
+	if o.updatedAt == "" {
+		return data
+	}
+	return withValue(data, o.updatedAt, time.Now())
+}
+
+// JSONColumns makes the write functions marshal the values of the named
+// columns to JSON text with encoding/json before binding them, so maps,
+// slices and structs can be stored in JSON columns directly. Values that are
+// already a string, []byte or json.RawMessage are taken to be JSON text and
+// bound as is, and NULL stays NULL. Other columns are never serialized.
+func JSONColumns(columns ...string) Option {
+	return func(o *options) {
+		o.jsonColumns = append(o.jsonColumns, columns...)
+	}
+}
+
+// insertData prepares rows for insertion, filling in the CreatedAt column and
+// encoding JSONColumns.
+func (o *options) insertData(data []map[string]interface{}) ([]map[string]interface{}, error) {
+	return o.encodeJSONRows(o.stampCreated(data))
+}
+
+// encodeJSONRows applies encodeJSON to each row of data.
+func (o *options) encodeJSONRows(data []map[string]interface{}) ([]map[string]interface{}, error) {
+	if len(o.jsonColumns) == 0 {
+		return data, nil
+	}
+	encoded := make([]map[string]interface{}, len(data))
+	for i, row := range data {
+		var err error
+		if encoded[i], err = o.encodeJSON(row); err != nil {
+			return nil, fmt.Errorf("mysqlutils: row %d: %w", i, err)
+		}
+	}
+	return encoded, nil
+}
+
+// encodeJSON returns row with the JSONColumns values marshaled. Like
+// withValue it copies row rather than modifying it.
+func (o *options) encodeJSON(row map[string]interface{}) (map[string]interface{}, error) {
+	var copied map[string]interface{}
+	for _, col := range o.jsonColumns {
+		v, ok := row[col]
+		if !ok || isNull(v) {
+			continue
+		}
+		switch v.(type) {
+		case string, []byte, json.RawMessage, RawExpr, increment:
+			continue
+		}
+
+		text, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("mysqlutils: column %s: %w", col, err)
+		}
+		if copied == nil {
+			copied = make(map[string]interface{}, len(row))
+			for k, v := range row {
+				copied[k] = v
+			}
+		}
+		copied[col] = string(text)
+	}
+	if copied == nil {
+		return row, nil
+	}
+	return copied, nil
+}
+
+// withValue returns row with key set to value unless row already has key. The
+// original map is copied rather than modified.
+func withValue(row map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	if _, ok := row[key]; ok {
+		return row
+	}
+
+	copied := make(map[string]interface{}, len(row)+1)
+	for k, v := range row {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+// WithTimeout bounds a single call to d, as if it were made with a context
+// created by context.WithTimeout. When the deadline passes the driver aborts
+// the statement and the call returns context.DeadlineExceeded. Selects also
+// carry a MAX_EXECUTION_TIME hint so the server stops the query itself. For
+// SelectEach the timeout covers the whole iteration, including fn.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// context derives the context for a call from ctx, applying WithTimeout.
+func (o *options) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, o.timeout)
+}
+
+// UpsertIf makes Upsert update a conflicting row only when the incoming value
+// of column compares to the stored one with op, one of =, !=, <>, <, <=, >
+// or >=. For example UpsertIf("updated_at", ">") keeps stale writes from
+// overwriting newer data. A row whose column is NULL is always updated.
+// Only one UpsertIf may be given per call: MySQL applies the assignments of
+// ON DUPLICATE KEY UPDATE in turn, so a second guard would be checked against
+// a row the first had already changed.
+func UpsertIf(column, op string) Option {
+	return func(o *options) {
+		o.upsertIf = append(o.upsertIf, Cond{Column: column, Op: op})
+	}
+}
+
+// DryRun makes Insert, Replace, InsertBatch, InsertReturningIDs, Upsert,
+// UpsertBatch, Update, UpdateAll, Delete, DeleteN and DeleteByIDs build their
+// statements and pass each one to fn with its arguments instead of running
+// it. They then report zero rows affected and a zero insert ID;
+// InsertReturningIDs returns a zero ID for every row. No connection is
+// needed, so db may be nil, which makes DryRun handy for reviewing generated
+// SQL and for asserting on it in tests. An upsert with no updateColumns still
+// reads the table's keys, so it needs a connection.
+func DryRun(fn func(query string, args []interface{})) Option {
+	return func(o *options) {
+		o.dryRun = fn
+	}
+}
+
+// dryRunResult is the sql.Result reported for statements skipped by DryRun.
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) { return 0, nil }
+func (dryRunResult) RowsAffected() (int64, error) { return 0, nil }
+
+// resolveDB is like the package-level resolveDB, except that under DryRun a
+// missing connection is fine since none is used.
+func (o *options) resolveDB(db Querier) (Querier, error) {
+	if o.dryRun != nil {
+		return db, nil
+	}
+	return resolveDB(db)
+}
+
+// exec runs a write statement, or only reports it under DryRun.
+func (o *options) exec(ctx context.Context, db Querier, query string, args ...interface{}) (sql.Result, error) {
+	if o.dryRun != nil {
+		o.dryRun(query, args)
+		return dryRunResult{}, nil
+	}
+	if o.stmtCache == nil {
+		return execContext(ctx, db, query, args...)
+	}
+
+	stmt, owned, err := o.prepare(ctx, db, query)
+	if err != nil {
+		return nil, err
+	}
+	if owned {
+		defer stmt.Close()
+	}
+	return stmtExecContext(ctx, stmt, query, args...)
+}
+
+// UseStmtCache makes Insert, Update, Delete and the other write functions run
+// their statements through c instead of preparing or sending them afresh.
+// In a transaction the cache is only used when the transaction is passed
+// through c.Tx.
+func UseStmtCache(c *StmtCache) Option {
+	return func(o *options) {
+		o.stmtCache = c
+	}
+}
+
+// prepare returns a prepared statement for query on db, taken from the
+// statement cache when there is one. owned reports whether the caller must
+// close it.
+func (o *options) prepare(ctx context.Context, db Querier, query string) (stmt *sql.Stmt, owned bool, err error) {
+	if o.stmtCache != nil {
+		stmt, owned, err := o.stmtCache.stmtFor(ctx, db, query)
+		if stmt != nil || err != nil {
+			return stmt, owned, err
+		}
+	}
+	stmt, err = db.PrepareContext(ctx, query)
+	return stmt, true, err
+}
+
+// inTx is like the package-level inTx, except that under DryRun fn runs
+// directly since there is nothing to commit.
+func (o *options) inTx(ctx context.Context, db Querier, fn func(q Querier) error) error {
+	if o.dryRun != nil {
+		return fn(db)
+	}
+	return inTx(ctx, db, fn)
+}
+
+// OmitZero makes InsertStructs leave out every field holding its zero value,
+// as if each were tagged with omitempty, so the columns get their defaults.
+func OmitZero() Option {
+	return func(o *options) {
+		o.omitZero = true
+	}
+}
+
+// LowerCaseKeys makes Select key each row by its column names in lower case,
+// so code looking up row["userid"] works whether MySQL reports the column as
+// userid or UserID. Column name lists, such as the one SelectWithColumns
+// returns, are lowered to match, and so are the names BoolColumns,
+// SelectMapBy and BatchKey look for. The default keeps names as MySQL
+// returns them.
+func LowerCaseKeys() Option {
+	return func(o *options) {
+		o.lowerKeys = true
+	}
+}
+
+// resultKey returns the key under which a row map holds the column name.
+func (o *options) resultKey(name string) string {
+	if o.lowerKeys {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// BinaryBytes makes Select return BLOB, BINARY and VARBINARY columns as
+// []byte rather than string, preserving binary data as is and avoiding a
+// copy of large values. TEXT and other character columns are unaffected.
+func BinaryBytes() Option {
+	return func(o *options) {
+		o.binaryBytes = true
+	}
+}
+
+// BoolColumns makes Select return the named result columns as bool, true
+// for any non-zero value. Use it for BIT(1) and TINYINT(1) flags: the driver
+// does not report column widths, so they cannot be told apart from wider BIT
+// and TINYINT columns automatically. Other BIT columns are returned as
+// uint64.
+func BoolColumns(columns ...string) Option {
+	return func(o *options) {
+		if o.boolColumns == nil {
+			o.boolColumns = map[string]bool{}
+		}
+		for _, c := range columns {
+			o.boolColumns[c] = true
+		}
+	}
+}
+
+// NativeTypes makes Select return integers as int64 (uint64 for UNSIGNED
+// BIGINT), FLOAT and DOUBLE as float64, DECIMAL as Decimal and DATE, DATETIME
+// and TIMESTAMP as time.Time, based on each column's database type. Without it
+// every value the driver returns as bytes is converted to a string.
+func NativeTypes() Option {
+	return func(o *options) {
+		o.nativeTypes = true
+	}
+}
+
+// DecimalParser makes Select convert DECIMAL values with parse, which gets
+// the exact textual value. It works with or without NativeTypes, and lets a
+// caller use a decimal package without this one depending on it:
+//
+//	DecimalParser(func(s string) (interface{}, error) { return decimal.NewFromString(s) })
+func DecimalParser(parse func(s string) (interface{}, error)) Option {
+	return func(o *options) {
+		o.decimalParser = parse
+	}
+}
+
+// orderByClause renders the ORDER BY clause, validating the column names since
+// they cannot be passed as bound parameters.
+func (o *options) orderByClause() (string, error) {
+	if len(o.orderBy) == 0 {
+		return "", nil
+	}
+
+	terms := make([]string, 0, len(o.orderBy))
+	for _, t := range o.orderBy {
+		if err := checkIdent(t.column); err != nil {
+			return "", fmt.Errorf("mysqlutils: ORDER BY: %w", err)
+		}
+		dir := strings.ToUpper(t.direction)
+		switch dir {
+		case "":
+			dir = "ASC"
+		case "ASC", "DESC":
+		default:
+			return "", fmt.Errorf("mysqlutils: invalid ORDER BY direction %q", t.direction)
+		}
+		terms = append(terms, quoteIdent(t.column)+" "+dir)
+	}
+	return " ORDER BY " + strings.Join(terms, ", "), nil
+}
+
+// maxLimit is the largest row count MySQL accepts; it is used when an offset
+// is given without a limit, since MySQL has no OFFSET without LIMIT.
+const maxLimit uint64 = 18446744073709551615
+
+// limitClause renders the LIMIT and OFFSET clause with bound parameters.
+func (o *options) limitClause() (string, []interface{}, error) {
+	if o.limit < 0 || o.offset < 0 {
+		return "", nil, fmt.Errorf("mysqlutils: negative LIMIT %d or OFFSET %d", o.limit, o.offset)
+	}
+
+	switch {
+	case o.limit > 0 && o.offset > 0:
+		return " LIMIT ? OFFSET ?", []interface{}{o.limit, o.offset}, nil
+	case o.limit > 0:
+		return " LIMIT ?", []interface{}{o.limit}, nil
+	case o.offset > 0:
+		return " LIMIT ? OFFSET ?", []interface{}{maxLimit, o.offset}, nil
+	}
+	return "", nil, nil
+}
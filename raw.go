@@ -0,0 +1,233 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Query runs an arbitrary SQL query and returns its rows in the same form as
+// Select. Use it when the query builders cannot express what you need; the
+// query text is sent as is, so only pass untrusted input through args.
+func Query(db Querier, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	return QueryContext(context.Background(), db, query, args...)
+}
+
+// QueryContext is like Query but runs the query with the given context.
+func QueryContext(ctx context.Context, db Querier, query string, args ...interface{}) (result []map[string]interface{}, err error) {
+	defer func(start time.Time) { observe(OpQuery, start, int64(len(result)), err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return nil, queryError("query", query, err)
+	}
+	defer rows.Close()
+
+	_, result, err = scanRows(rows, newOptions(nil))
+	if err != nil {
+		return nil, queryError("query", query, err)
+	}
+	return result, nil
+}
+
+// Exec runs an arbitrary SQL statement and returns the number of rows it
+// affected.
+func Exec(db Querier, query string, args ...interface{}) (int64, error) {
+	return ExecContext(context.Background(), db, query, args...)
+}
+
+// ExecContext is like Exec but runs the statement with the given context.
+func ExecContext(ctx context.Context, db Querier, query string, args ...interface{}) (affected int64, err error) {
+	defer func(start time.Time) { observe(OpExec, start, affected, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := execContext(ctx, db, query, args...)
+	if err != nil {
+		return 0, queryError("exec", query, err)
+	}
+
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return 0, queryError("exec", query, err)
+	}
+	return affected, nil
+}
+
+// ExecScript runs statements in order inside a single transaction, rolling
+// back and stopping at the first failure, which is reported as a
+// *ScriptError. Note that MySQL commits implicitly around DDL such as CREATE
+// TABLE, so only data changes are guaranteed to roll back.
+func ExecScript(db Querier, statements []string) error {
+	return ExecScriptContext(context.Background(), db, statements)
+}
+
+// ExecScriptContext is like ExecScript but runs the statements with the given
+// context.
+func ExecScriptContext(ctx context.Context, db Querier, statements []string) (err error) {
+	defer func(start time.Time) { observe(OpExec, start, 0, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, db, func(q Querier) error {
+		for i, stmt := range statements {
+			if _, err := execContext(ctx, q, stmt); err != nil {
+				return &ScriptError{Index: i, Statement: stmt, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+// ScriptError reports the statement that made ExecScript fail.
+type ScriptError struct {
+	// Index is the position of the failed statement in the script.
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("mysqlutils: script statement %d %q: %v", e.Index, e.Statement, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// Scalar runs a query returning a single column and scans the first row into
+// a T, as in Scalar[time.Time](db, "SELECT MAX(created_at) FROM orders"). It
+// returns ErrNoRows when the query returns no row. Use a pointer or sql.Null*
+// type for T when the value may be NULL.
+func Scalar[T any](db Querier, query string, args ...interface{}) (T, error) {
+	return ScalarContext[T](context.Background(), db, query, args...)
+}
+
+// ScalarContext is like Scalar but runs the query with the given context.
+func ScalarContext[T any](ctx context.Context, db Querier, query string, args ...interface{}) (value T, err error) {
+	defer func(start time.Time) {
+		var rows int64
+		if err == nil {
+			rows = 1
+		}
+		observe(OpQuery, start, rows, err)
+	}(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return value, err
+	}
+
+	err = queryRowScan(ctx, db, query, args, &value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return value, ErrNoRows
+	}
+	if err != nil {
+		return value, queryError("scalar", query, err)
+	}
+	localizeScanned(&value)
+	return value, nil
+}
+
+// Explain runs EXPLAIN on query and returns the plan rows in the same form as
+// Query, one per table accessed. query may be any statement MySQL can
+// explain; it is not executed.
+func Explain(db Querier, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	return ExplainContext(context.Background(), db, query, args...)
+}
+
+// ExplainContext is like Explain but runs the query with the given context.
+func ExplainContext(ctx context.Context, db Querier, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	return QueryContext(ctx, db, "EXPLAIN "+query, args...)
+}
+
+// ExplainJSON runs EXPLAIN FORMAT=JSON on query and returns the plan as a
+// JSON document, which includes cost estimates the tabular form lacks.
+func ExplainJSON(db Querier, query string, args ...interface{}) (string, error) {
+	return ExplainJSONContext(context.Background(), db, query, args...)
+}
+
+// ExplainJSONContext is like ExplainJSON but runs the query with the given
+// context.
+func ExplainJSONContext(ctx context.Context, db Querier, query string, args ...interface{}) (string, error) {
+	return ScalarContext[string](ctx, db, "EXPLAIN FORMAT=JSON "+query, args...)
+}
+
+// ExplainAnalyze runs EXPLAIN ANALYZE on query, available from MySQL 8.0.18,
+// and returns the plan tree annotated with actual timings and row counts.
+// Unlike Explain it executes query, so take care with statements that change
+// data.
+func ExplainAnalyze(db Querier, query string, args ...interface{}) (string, error) {
+	return ExplainAnalyzeContext(context.Background(), db, query, args...)
+}
+
+// ExplainAnalyzeContext is like ExplainAnalyze but runs the query with the
+// given context.
+func ExplainAnalyzeContext(ctx context.Context, db Querier, query string, args ...interface{}) (string, error) {
+	return ScalarContext[string](ctx, db, "EXPLAIN ANALYZE "+query, args...)
+}
+
+// CallProcedure calls the stored procedure name with args bound to its
+// parameters and returns every result set it produces, in order, each in the
+// same form as Query. name may be qualified with a schema. OUT parameters are
+// not supported; select their values in the procedure instead.
+func CallProcedure(db Querier, name string, args ...interface{}) ([][]map[string]interface{}, error) {
+	return CallProcedureContext(context.Background(), db, name, args...)
+}
+
+// CallProcedureContext is like CallProcedure but runs the call with the given
+// context.
+func CallProcedureContext(ctx context.Context, db Querier, name string, args ...interface{}) (sets [][]map[string]interface{}, err error) {
+	defer func(start time.Time) {
+		var rows int64
+		for _, set := range sets {
+			rows += int64(len(set))
+		}
+		observe(OpQuery, start, rows, err)
+	}(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIdent(name); err != nil {
+		return nil, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	query := "CALL " + quoteIdent(name) + "(" + placeholders + ")"
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return nil, queryError("call", query, err)
+	}
+	defer rows.Close()
+
+	sets = [][]map[string]interface{}{}
+	for {
+		// Each result set has its own columns, so scanRows sets up a new
+		// scanner every time.
+		scanner, result, err := scanRows(rows, newOptions(nil))
+		if err != nil {
+			return nil, queryError("call", query, err)
+		}
+		if len(scanner.columnNames) > 0 {
+			sets = append(sets, result)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError("call", query, err)
+	}
+	return sets, nil
+}
@@ -0,0 +1,228 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+)
+
+// ReadOnly wraps db so that it can only be read from, guarding replica
+// connections against accidental writes. Select, Count, Exists and the other
+// reads work as usual, while Insert, Update, Delete, Truncate and every other
+// function that executes a statement return an error wrapping ErrReadOnly
+// without sending anything to the server. Preparing statements is refused
+// too, since a prepared statement could write.
+//
+// Query accepts only statements starting with SELECT, WITH, SHOW, EXPLAIN,
+// DESCRIBE or DESC, and rejects any of them that could still change data:
+// a WITH or EXPLAIN leading into INSERT, REPLACE, UPDATE or DELETE, SELECT
+// ... INTO, which writes files or variables, and multiple statements. The
+// check is deliberately conservative, so such a keyword anywhere outside a
+// quoted string or comment rejects the query; quote columns named like
+// keywords. SELECT ... FOR UPDATE is allowed.
+//
+// A nil db wraps the connection registered with SetDefaultDB, looked up on
+// every call. Functions that normally run their queries in a transaction run
+// them directly on the wrapped connection instead.
+func ReadOnly(db Querier) Querier {
+	return readOnly{db: db}
+}
+
+// readOnly is the Querier returned by ReadOnly.
+type readOnly struct {
+	db Querier
+}
+
+// failingConnector is a driver.Connector that never connects, for building
+// a *sql.DB whose every query fails with err. readOnly uses it to report
+// errors through QueryRowContext, since a *sql.Row cannot be built directly.
+type failingConnector struct {
+	err error
+}
+
+func (c failingConnector) Connect(context.Context) (driver.Conn, error) { return nil, c.err }
+func (c failingConnector) Driver() driver.Driver                        { return failingDriver(c) }
+
+// failingDriver is the driver.Driver of failingConnector.
+type failingDriver failingConnector
+
+func (d failingDriver) Open(string) (driver.Conn, error) { return nil, d.err }
+
+var (
+	readOnlyDB = sql.OpenDB(failingConnector{err: ErrReadOnly})
+	noDB       = sql.OpenDB(failingConnector{err: ErrNoDB})
+)
+
+// readStatements lists the leading keywords of the statements readOnly lets
+// through.
+var readStatements = map[string]bool{
+	"SELECT":   true,
+	"WITH":     true,
+	"SHOW":     true,
+	"EXPLAIN":  true,
+	"DESCRIBE": true,
+	"DESC":     true,
+}
+
+// isRead reports whether query starts with one of readStatements, allowing
+// for opening parentheses as in (SELECT ...) UNION (SELECT ...), and contains
+// nothing that could make it write.
+func isRead(query string) bool {
+	tokens := sqlTokens(query)
+	first := 0
+	for first < len(tokens) && tokens[first] == "(" {
+		first++
+	}
+	if first == len(tokens) || !readStatements[tokens[first]] {
+		return false
+	}
+
+	for i, tok := range tokens {
+		var next, prev string
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		switch tok {
+		case ";":
+			// Only a trailing semicolon is allowed.
+			if next != "" && next != ";" {
+				return false
+			}
+		case "INSERT", "REPLACE":
+			// Both are also string functions, as in REPLACE(name, ?, ?).
+			if next != "(" {
+				return false
+			}
+		case "UPDATE":
+			if prev != "FOR" {
+				return false
+			}
+		case "DELETE", "INTO":
+			return false
+		}
+	}
+	return true
+}
+
+// sqlTokens splits query into upper-cased words and single punctuation
+// characters. Quoted strings and identifiers become a lone quote token and
+// comments are dropped, except MySQL's executable /*! ... */ comments, whose
+// contents the server runs and so are tokenized like the rest of the query.
+func sqlTokens(query string) []string {
+	var tokens []string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(query, i)
+			tokens = append(tokens, string(c))
+		case isLineComment(query[i:]):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "/*!"):
+			i += 3
+			for i < len(query) && '0' <= query[i] && query[i] <= '9' {
+				i++ // The minimum server version.
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "*/"):
+			i += 2 // The end of an executable comment.
+		case isWordChar(c):
+			start := i
+			for i < len(query) && isWordChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, strings.ToUpper(query[start:i]))
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+// isLineComment reports whether s starts with a comment running to the end of
+// the line: # or, as MySQL requires, -- followed by whitespace.
+func isLineComment(s string) bool {
+	if strings.HasPrefix(s, "#") {
+		return true
+	}
+	if !strings.HasPrefix(s, "--") {
+		return false
+	}
+	return len(s) == 2 || strings.ContainsRune(" \t\r\n", rune(s[2]))
+}
+
+// isWordChar reports whether c can be part of an unquoted keyword or name.
+// Bytes of multi-byte UTF-8 characters count, as MySQL allows those in
+// unquoted names.
+func isWordChar(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '$' || c >= 0x80
+}
+
+// skipQuoted returns the index just past the quoted text starting at
+// query[i], allowing for doubled quotes and, except in identifiers,
+// backslash escapes. An unterminated quote runs to the end of query.
+func skipQuoted(query string, i int) int {
+	quote := query[i]
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+func (r readOnly) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, ErrReadOnly
+}
+
+func (r readOnly) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if !isRead(query) {
+		return nil, ErrReadOnly
+	}
+	db, err := resolveDB(r.db)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryContext(ctx, query, args...)
+}
+
+func (r readOnly) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if !isRead(query) {
+		return readOnlyDB.QueryRowContext(ctx, query, args...)
+	}
+	db, err := resolveDB(r.db)
+	if err != nil {
+		return noDB.QueryRowContext(ctx, query, args...)
+	}
+	return db.QueryRowContext(ctx, query, args...)
+}
+
+func (r readOnly) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, ErrReadOnly
+}
@@ -0,0 +1,69 @@
+package mysqlutils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsRead(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM users", true},
+		{"  (select 1) UNION (select 2)", true},
+		{"WITH c AS (SELECT 1) SELECT * FROM c", true},
+		{"SHOW TABLES", true},
+		{"EXPLAIN SELECT * FROM users", true},
+		{"EXPLAIN ANALYZE SELECT * FROM users", true},
+		{"SELECT * FROM users WHERE id = ? FOR UPDATE", true},
+		{"SELECT REPLACE(name, 'a', 'b'), INSERT(name, 1, 2, 'x') FROM users", true},
+		{"SELECT 'DELETE FROM users; UPDATE users' FROM dual;", true},
+		{"SELECT `update`, `into` FROM t -- delete\n", true},
+		{"SELECT 1 /* UPDATE users */", true},
+
+		{"DELETE FROM users", false},
+		{"WITH c AS (SELECT 1) DELETE FROM users", false},
+		{"WITH c AS (SELECT 1) UPDATE users SET a = 1", false},
+		{"EXPLAIN ANALYZE DELETE FROM users", false},
+		{"EXPLAIN FORMAT=TREE UPDATE users SET a = 1", false},
+		{"DESC INSERT INTO users VALUES (1)", false},
+		{"EXPLAIN REPLACE INTO users VALUES (1)", false},
+		{"SELECT * FROM users INTO OUTFILE '/tmp/u'", false},
+		{"SELECT * INTO DUMPFILE '/tmp/u' FROM users", false},
+		{"SELECT 1; DROP TABLE users", false},
+		{"SELECT 1 /*! ; DELETE FROM users */", false},
+		{"SELECT 1 -- it's\n; DELETE FROM users; -- '", false},
+		{"SELECT 'it\\'s'; DELETE FROM users", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isRead(tt.query); got != tt.want {
+			t.Errorf("isRead(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestReadOnlyRejectsWrites(t *testing.T) {
+	db := ReadOnly(nil)
+	if _, err := Query(db, "WITH c AS (SELECT 1) DELETE FROM users"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Query: got %v, want ErrReadOnly", err)
+	}
+	if _, err := ExplainAnalyze(db, "UPDATE users SET a = 1"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("ExplainAnalyze: got %v, want ErrReadOnly", err)
+	}
+	if err := Truncate(db, "users"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Truncate: got %v, want ErrReadOnly", err)
+	}
+}
+
+func TestReadOnlyNilWithoutDefault(t *testing.T) {
+	SetDefaultDB(nil)
+	db := ReadOnly(nil)
+	if _, err := Query(db, "SELECT 1"); !errors.Is(err, ErrNoDB) {
+		t.Errorf("Query: got %v, want ErrNoDB", err)
+	}
+	if _, err := Scalar[int](db, "SELECT 1"); !errors.Is(err, ErrNoDB) {
+		t.Errorf("Scalar: got %v, want ErrNoDB", err)
+	}
+}
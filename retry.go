@@ -0,0 +1,80 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// retryBaseDelay and retryMaxDelay bound the exponential backoff between
+// attempts of WithRetry.
+const (
+	retryBaseDelay = 50 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// txAttempts is the number of times RunInTx tries a transaction.
+const txAttempts = 5
+
+// RunInTx runs fn in a transaction begun with opts, which may set the
+// isolation level, and commits it as WithTransaction does. If fn or the commit
+// fails with a deadlock or lock wait timeout, the whole transaction is rolled
+// back and run again in a new one, with backoff, up to five attempts in all;
+// the last error is returned. fn may therefore run more than once, and should
+// have no effects outside the transaction.
+func RunInTx(db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	return RunInTxContext(context.Background(), db, opts, fn)
+}
+
+// RunInTxContext is like RunInTx but begins each transaction with the given
+// context, and stops retrying once it is done.
+func RunInTxContext(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	return WithRetryContext(ctx, txAttempts, func() error {
+		return WithTransactionContext(ctx, db, opts, fn)
+	})
+}
+
+// WithRetry calls fn up to attempts times, retrying with exponential backoff
+// while it fails with a deadlock (1213) or lock wait timeout (1205). Any other
+// error is returned immediately; after the last attempt the last error is
+// returned; fn always runs at least once. fn should wrap a whole unit of
+// work, since MySQL rolls back the transaction of a deadlock victim.
+func WithRetry(attempts int, fn func() error) error {
+	return WithRetryContext(context.Background(), attempts, fn)
+}
+
+// WithRetryContext is like WithRetry but stops waiting between attempts once
+// ctx is done, returning the context's error.
+func WithRetryContext(ctx context.Context, attempts int, fn func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	delay := retryBaseDelay
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+			if delay *= 2; delay > retryMaxDelay {
+				delay = retryMaxDelay
+			}
+		}
+
+		err = fn()
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// isRetryable reports whether err is a transient MySQL locking error.
+func isRetryable(err error) bool {
+	return IsDeadlock(err) || IsLockWaitTimeout(err)
+}
@@ -0,0 +1,149 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Rows iterates over the result of SelectRows one row at a time:
+//
+//	rows, err := SelectRows(db, "events", nil, where)
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		row := rows.Map()
+//		...
+//	}
+//	return rows.Err()
+//
+// The underlying *sql.Rows is closed once Next returns false or Close is
+// called, whichever comes first. Rows is not safe for concurrent use.
+type Rows struct {
+	rows    *sql.Rows
+	scanner *rowScanner
+	query   string
+	cancel  context.CancelFunc
+
+	row map[string]interface{}
+	err error
+
+	// start, count and closed feed the MetricsCollector report sent by the
+	// first Close.
+	start  time.Time
+	count  int64
+	closed bool
+}
+
+// SelectRows runs the same query as Select but returns an iterator instead of
+// reading every row up front. The caller must call Close unless Next has
+// returned false, or the connection stays busy.
+func SelectRows(db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (*Rows, error) {
+	return SelectRowsContext(context.Background(), db, tableName, columns, whereClause, opts...)
+}
+
+// SelectRowsContext is like SelectRows but runs the query with the given
+// context, which must stay live until iteration is done.
+func SelectRowsContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (r *Rows, err error) {
+	start := time.Now()
+	defer func() {
+		// Once the iterator exists, Close reports the operation.
+		if err != nil {
+			observe(OpSelect, start, 0, err)
+		}
+	}()
+	db, err = resolveDB(db)
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	query, args, err := buildSelect(tableName, columns, whereClause, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkLock(db); err != nil {
+		return nil, err
+	}
+
+	// The timeout, if any, covers the whole iteration, so it is only
+	// released by Close.
+	ctx, cancel := o.context(ctx)
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		cancel()
+		return nil, queryError("select", query, err)
+	}
+
+	scanner, err := newRowScanner(rows, o)
+	if err != nil {
+		rows.Close()
+		cancel()
+		return nil, queryError("select", query, err)
+	}
+	return &Rows{rows: rows, scanner: scanner, query: query, cancel: cancel, start: start}, nil
+}
+
+// Next advances to the next row, reporting false when there are no more rows
+// or an error occurred; check Err to tell the two apart.
+func (r *Rows) Next() bool {
+	r.row = nil
+	if r.err != nil || !r.rows.Next() {
+		r.Close()
+		return false
+	}
+
+	row, err := r.scanner.scan()
+	if err != nil {
+		r.err = queryError("select", r.query, err)
+		r.Close()
+		return false
+	}
+	r.row = row
+	r.count++
+	return true
+}
+
+// Map returns the current row, as Select would. It returns nil before the
+// first call to Next and after Next returns false.
+func (r *Rows) Map() map[string]interface{} {
+	return r.row
+}
+
+// Scan stores the current row in *dest. It is a convenience for callers that
+// prefer database/sql's Scan style over Map.
+func (r *Rows) Scan(dest *map[string]interface{}) error {
+	if r.row == nil {
+		return queryError("select", r.query, sql.ErrNoRows)
+	}
+	*dest = r.row
+	return nil
+}
+
+// Columns returns the result's column names in SELECT list order.
+func (r *Rows) Columns() []string {
+	return r.scanner.columnNames
+}
+
+// Err returns the error, if any, that ended the iteration.
+func (r *Rows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.rows.Err(); err != nil {
+		return queryError("select", r.query, err)
+	}
+	return nil
+}
+
+// Close releases the result set. It is safe to call more than once.
+func (r *Rows) Close() error {
+	err := r.rows.Close()
+	r.cancel()
+	if !r.closed {
+		r.closed = true
+		observe(OpSelect, r.start, r.count, r.Err())
+	}
+	return err
+}
@@ -0,0 +1,331 @@
+package mysqlutils
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	locationMu sync.RWMutex
+	location   *time.Location
+)
+
+// SetLocation sets the time zone in which scanned DATE, DATETIME and
+// TIMESTAMP values are interpreted. MySQL sends them as wall-clock times
+// without a zone, so by default they come back in UTC. With a location set,
+// the same wall-clock time is returned in loc instead, both for values parsed
+// by the NativeTypes option and for time.Time values parsed by the driver
+// with parseTime=true, whatever its loc parameter. This applies to the row
+// maps of Select and the functions built on it, and to time.Time,
+// *time.Time and sql.NullTime destinations of SelectInto and Scalar. TIMESTAMP
+// values are sent in the session time zone, which should match loc. nil
+// restores UTC. TIME columns hold durations rather than times of day and are
+// unaffected.
+func SetLocation(loc *time.Location) {
+	locationMu.Lock()
+	location = loc
+	locationMu.Unlock()
+}
+
+func currentLocation() *time.Location {
+	locationMu.RLock()
+	defer locationMu.RUnlock()
+	return location
+}
+
+// scanRows reads every remaining row into a map keyed by column name. It also
+// returns the scanner used, which describes the result's columns.
+func scanRows(rows *sql.Rows, o *options) (*rowScanner, []map[string]interface{}, error) {
+	scanner, err := newRowScanner(rows, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := []map[string]interface{}{}
+
+	for rows.Next() {
+		rowData, err := scanner.scan()
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, rowData)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return scanner, result, nil
+}
+
+// rowScanner converts the current row of a result set into a map, reusing
+// the column metadata across rows.
+type rowScanner struct {
+	rows *sql.Rows
+	o    *options
+	// columnNames are the row map keys, in result order.
+	columnNames []string
+	columnTypes []*sql.ColumnType
+	// boolColumns holds the BoolColumns names, as result keys.
+	boolColumns map[string]bool
+	loc         *time.Location
+}
+
+func newRowScanner(rows *sql.Rows, o *options) (*rowScanner, error) {
+	columnNames, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range columnNames {
+		columnNames[i] = o.resultKey(name)
+	}
+	boolColumns := o.boolColumns
+	if o.lowerKeys && len(boolColumns) > 0 {
+		boolColumns = make(map[string]bool, len(o.boolColumns))
+		for name := range o.boolColumns {
+			boolColumns[o.resultKey(name)] = true
+		}
+	}
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &rowScanner{
+		rows:        rows,
+		o:           o,
+		columnNames: columnNames,
+		columnTypes: columnTypes,
+		boolColumns: boolColumns,
+		loc:         currentLocation(),
+	}, nil
+}
+
+// scan reads the row rows.Next last advanced to.
+func (s *rowScanner) scan() (map[string]interface{}, error) {
+	columnPointers := make([]interface{}, len(s.columnNames))
+	columnValues := make([]interface{}, len(s.columnNames))
+
+	for i := range columnValues {
+		columnPointers[i] = &columnValues[i]
+	}
+
+	err := s.rows.Scan(columnPointers...)
+	if err != nil {
+		return nil, err
+	}
+
+	rowData := make(map[string]interface{})
+	for i, name := range s.columnNames {
+		// NULL scans as a nil interface, never as empty bytes, so it
+		// stays distinguishable from an empty string.
+		if columnValues[i] == nil {
+			rowData[name] = nil
+			continue
+		}
+		v, err := s.convert(i, columnValues[i])
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", name, err)
+		}
+		if t, ok := v.(time.Time); ok && s.loc != nil && !t.IsZero() {
+			v = inLocation(t, s.loc)
+		}
+		rowData[name] = v
+	}
+	return rowData, nil
+}
+
+// convert turns the non-NULL value scanned for column i into the Go value
+// stored in the row map.
+func (s *rowScanner) convert(i int, value interface{}) (interface{}, error) {
+	typeName := s.columnTypes[i].DatabaseTypeName()
+
+	if s.boolColumns[s.columnNames[i]] {
+		return boolValue(value, typeName)
+	}
+	// BIT values arrive as raw big-endian bytes, which are meaningless as a
+	// string.
+	if typeName == "BIT" {
+		return bitValue(value)
+	}
+	if s.o.binaryBytes && binaryTypes[typeName] {
+		return value, nil
+	}
+	if typeName == "DECIMAL" && (s.o.nativeTypes || s.o.decimalParser != nil) {
+		return decimalValue(value, s.o.decimalParser)
+	}
+	if s.o.nativeTypes {
+		return nativeValue(value, typeName)
+	}
+
+	if v, ok := value.([]byte); ok {
+		return string(v), nil
+	}
+	return value, nil
+}
+
+// binaryTypes lists the column types holding binary strings. The driver
+// reports TEXT columns under their own names.
+var binaryTypes = map[string]bool{
+	"BINARY":     true,
+	"VARBINARY":  true,
+	"TINYBLOB":   true,
+	"BLOB":       true,
+	"MEDIUMBLOB": true,
+	"LONGBLOB":   true,
+}
+
+// Decimal holds a DECIMAL value in its exact textual form, as returned for
+// DECIMAL columns by the NativeTypes option. Converting it to a float is left
+// to the caller so money amounts never lose precision silently; use the
+// DecimalParser option to get a decimal type of your choice instead.
+type Decimal string
+
+// String returns the decimal as MySQL formatted it.
+func (d Decimal) String() string {
+	return string(d)
+}
+
+// MarshalJSON encodes the decimal as a JSON number with its exact digits.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d), nil
+}
+
+// Float64 converts the decimal to the nearest float64, which may lose
+// precision.
+func (d Decimal) Float64() (float64, error) {
+	return strconv.ParseFloat(string(d), 64)
+}
+
+// decimalValue converts a DECIMAL value with parse, or to a Decimal when
+// parse is nil.
+func decimalValue(value interface{}, parse func(string) (interface{}, error)) (interface{}, error) {
+	var text string
+	switch v := value.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	if parse != nil {
+		return parse(text)
+	}
+	return Decimal(text), nil
+}
+
+// bitValue decodes a BIT value into an integer.
+func bitValue(value interface{}) (uint64, error) {
+	b, ok := value.([]byte)
+	if !ok || len(b) > 8 {
+		return 0, fmt.Errorf("cannot decode %T as BIT", value)
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// boolValue converts a BIT or integer flag to a bool.
+func boolValue(value interface{}, typeName string) (bool, error) {
+	if typeName == "BIT" {
+		n, err := bitValue(value)
+		return n != 0, err
+	}
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("cannot convert %q to bool", v)
+		}
+		return n != 0, nil
+	}
+	return false, fmt.Errorf("cannot convert %T to bool", value)
+}
+
+// nativeValue converts a scanned value to the Go type matching its MySQL
+// column type. The text protocol returns every value as []byte, while the
+// binary protocol used for queries with arguments already returns integers,
+// floats and, with parseTime, times.
+func nativeValue(value interface{}, typeName string) (interface{}, error) {
+	switch v := value.(type) {
+	case []byte:
+		return parseNative(string(v), typeName)
+	case float32:
+		return float64(v), nil
+	default:
+		return v, nil
+	}
+}
+
+func parseNative(s, typeName string) (interface{}, error) {
+	switch typeName {
+	case "UNSIGNED BIGINT":
+		return strconv.ParseUint(s, 10, 64)
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED INT":
+		return strconv.ParseInt(s, 10, 64)
+	case "FLOAT", "DOUBLE":
+		return strconv.ParseFloat(s, 64)
+	case "DATE", "DATETIME", "TIMESTAMP":
+		return parseDateTime(s)
+	default:
+		return s, nil
+	}
+}
+
+// inLocation returns the time with the same wall clock as t in loc.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// localizeScanned applies the SetLocation location to the times that
+// rows.Scan stored through dest, for callers scanning into their own values
+// rather than through a rowScanner. Zero times are left alone.
+func localizeScanned(dest ...interface{}) {
+	loc := currentLocation()
+	if loc == nil {
+		return
+	}
+	for _, d := range dest {
+		switch p := d.(type) {
+		case *time.Time:
+			if !p.IsZero() {
+				*p = inLocation(*p, loc)
+			}
+		case **time.Time:
+			if *p != nil && !(*p).IsZero() {
+				**p = inLocation(**p, loc)
+			}
+		case *sql.NullTime:
+			if p.Valid && !p.Time.IsZero() {
+				p.Time = inLocation(p.Time, loc)
+			}
+		}
+	}
+}
+
+// parseDateTime parses a DATE, DATETIME or TIMESTAMP value as sent by MySQL.
+// Zero dates such as 0000-00-00 map to the zero time.Time.
+func parseDateTime(s string) (time.Time, error) {
+	if strings.HasPrefix(s, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	layout := "2006-01-02 15:04:05.999999"
+	if len(s) == len("2006-01-02") {
+		layout = "2006-01-02"
+	}
+	return time.Parse(layout, s)
+}
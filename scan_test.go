@@ -0,0 +1,40 @@
+package mysqlutils
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestLocalizeScanned(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	SetLocation(loc)
+	t.Cleanup(func() { SetLocation(nil) })
+
+	wall := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	plain := wall
+	ptr := &time.Time{}
+	*ptr = wall
+	null := sql.NullTime{Time: wall, Valid: true}
+	var zero time.Time
+	var nilPtr *time.Time
+
+	localizeScanned(&plain, &ptr, &null, &zero, &nilPtr)
+
+	want := time.Date(2024, 3, 1, 12, 30, 0, 0, loc)
+	if !plain.Equal(want) || plain.Location() != loc {
+		t.Errorf("time.Time = %v, want %v", plain, want)
+	}
+	if !ptr.Equal(want) || ptr.Location() != loc {
+		t.Errorf("*time.Time = %v, want %v", *ptr, want)
+	}
+	if !null.Time.Equal(want) || null.Time.Location() != loc {
+		t.Errorf("sql.NullTime = %v, want %v", null.Time, want)
+	}
+	if !zero.IsZero() {
+		t.Errorf("zero time changed to %v", zero)
+	}
+	if nilPtr != nil {
+		t.Errorf("nil *time.Time changed to %v", nilPtr)
+	}
+}
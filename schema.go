@@ -0,0 +1,284 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ColumnInfo describes a table column as reported by information_schema.
+type ColumnInfo struct {
+	Name string
+	// DataType is the bare type name, such as "varchar" or "int".
+	DataType string
+	// ColumnType is the full type definition, such as "varchar(255)" or
+	// "int unsigned".
+	ColumnType string
+	Nullable   bool
+	// Key is "PRI", "UNI" or "MUL" for indexed columns and empty otherwise.
+	Key string
+	// Default is the column default, or nil when there is none.
+	Default *string
+	// Extra holds attributes such as "auto_increment".
+	Extra string
+}
+
+// Columns lists the columns of tableName in table order. tableName may be
+// qualified with a schema as in "shop.orders"; otherwise the current database
+// is used.
+func Columns(db Querier, tableName string) ([]ColumnInfo, error) {
+	return ColumnsContext(context.Background(), db, tableName)
+}
+
+// ColumnsContext is like Columns but runs the query with the given context.
+func ColumnsContext(ctx context.Context, db Querier, tableName string) ([]ColumnInfo, error) {
+	db, err := resolveDB(db)
+	if err != nil {
+		return nil, err
+	}
+	filter, args := tableFilter(tableName)
+	query := "SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA" +
+		" FROM information_schema.COLUMNS WHERE " + filter + " ORDER BY ORDINAL_POSITION"
+
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return nil, queryError("list columns", query, err)
+	}
+	defer rows.Close()
+
+	columns := []ColumnInfo{}
+	for rows.Next() {
+		var c ColumnInfo
+		var nullable string
+		var def sql.NullString
+		if err := rows.Scan(&c.Name, &c.DataType, &c.ColumnType, &nullable, &c.Key, &def, &c.Extra); err != nil {
+			return nil, queryError("list columns", query, err)
+		}
+		c.Nullable = nullable == "YES"
+		if def.Valid {
+			c.Default = &def.String
+		}
+		columns = append(columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError("list columns", query, err)
+	}
+	return columns, nil
+}
+
+// Tables lists the base tables in schema, sorted by name. An empty schema
+// means the current database.
+func Tables(db Querier, schema string) ([]string, error) {
+	return TablesContext(context.Background(), db, schema)
+}
+
+// TablesContext is like Tables but runs the query with the given context.
+func TablesContext(ctx context.Context, db Querier, schema string) ([]string, error) {
+	db, err := resolveDB(db)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME"
+	var args []interface{}
+	if schema != "" {
+		query = "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE' ORDER BY TABLE_NAME"
+		args = []interface{}{schema}
+	}
+
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return nil, queryError("list tables", query, err)
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, queryError("list tables", query, err)
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError("list tables", query, err)
+	}
+	return tables, nil
+}
+
+// tableFilter returns an information_schema condition matching tableName,
+// which may be qualified with a schema, along with its arguments.
+func tableFilter(tableName string) (string, []interface{}) {
+	if schema, table, ok := strings.Cut(tableName, "."); ok {
+		return "TABLE_SCHEMA = ? AND TABLE_NAME = ?", []interface{}{schema, table}
+	}
+	return "TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", []interface{}{tableName}
+}
+
+// EnsureTable creates table name from the fields of the struct model unless a
+// table by that name already exists, using CREATE TABLE IF NOT EXISTS. It is
+// meant for bootstrapping prototypes and tools, not as a migration system:
+// an existing table is left untouched even if it differs from model.
+//
+// Columns are named as for SelectInto and typed from the field types: string
+// as VARCHAR(255), integers as the matching INT type, bool as TINYINT(1),
+// floats as FLOAT or DOUBLE, []byte as BLOB and time.Time as DATETIME.
+// Pointer and sql.Null* fields are nullable; all others are NOT NULL. A sql
+// tag adjusts a column with comma-separated settings:
+//
+//	ID   int64  `db:"id" sql:"pk,auto_increment"`
+//	Code string `db:"code" sql:"type=CHAR(3)"`
+//
+// pk adds the column to the primary key, auto_increment adds AUTO_INCREMENT,
+// null makes the column nullable and type= replaces the column type. The type
+// is written into the statement as is.
+func EnsureTable(db Querier, name string, model interface{}) error {
+	return EnsureTableContext(context.Background(), db, name, model)
+}
+
+// EnsureTableContext is like EnsureTable but runs the statement with the given
+// context.
+func EnsureTableContext(ctx context.Context, db Querier, name string, model interface{}) error {
+	db, err := resolveDB(db)
+	if err != nil {
+		return err
+	}
+	query, err := buildCreateTable(name, model)
+	if err != nil {
+		return err
+	}
+	if _, err := execContext(ctx, db, query); err != nil {
+		return queryError("create table", query, err)
+	}
+	return nil
+}
+
+// buildCreateTable renders the CREATE TABLE IF NOT EXISTS statement for
+// EnsureTable.
+func buildCreateTable(name string, model interface{}) (string, error) {
+	if err := checkIdent(name); err != nil {
+		return "", err
+	}
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return "", fmt.Errorf("mysqlutils: EnsureTable needs a struct model, got nil")
+	}
+	fields, err := structFields(t)
+	if err != nil {
+		return "", err
+	}
+
+	defs := make([]string, 0, len(fields)+1)
+	var keys []string
+	for _, f := range fields {
+		if err := checkIdent(f.column); err != nil {
+			return "", err
+		}
+		colType, nullable := columnType(f.field.Type)
+		var pk, autoIncrement bool
+		for _, setting := range strings.Split(f.field.Tag.Get("sql"), ",") {
+			setting = strings.TrimSpace(setting)
+			switch {
+			case setting == "":
+			case setting == "pk":
+				pk = true
+			case setting == "auto_increment":
+				autoIncrement = true
+			case setting == "null":
+				nullable = true
+			case strings.HasPrefix(setting, "type="):
+				colType = strings.TrimPrefix(setting, "type=")
+			default:
+				return "", fmt.Errorf("mysqlutils: field %s: unknown sql tag setting %q", f.field.Name, setting)
+			}
+		}
+		if colType == "" {
+			return "", fmt.Errorf("mysqlutils: field %s: no column type for %s; set one with sql:\"type=...\"", f.field.Name, f.field.Type)
+		}
+
+		def := quoteName(f.column) + " " + colType
+		if nullable {
+			def += " NULL"
+		} else {
+			def += " NOT NULL"
+		}
+		if autoIncrement {
+			def += " AUTO_INCREMENT"
+		}
+		defs = append(defs, def)
+		if pk {
+			keys = append(keys, quoteName(f.column))
+		}
+	}
+	if len(keys) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(keys, ", ")+")")
+	}
+
+	return "CREATE TABLE IF NOT EXISTS " + quoteIdent(name) + " (" + strings.Join(defs, ", ") + ")", nil
+}
+
+// columnType returns the MySQL column type for a Go field type, or an empty
+// string when there is no obvious mapping, and whether the column should
+// allow NULL.
+func columnType(t reflect.Type) (string, bool) {
+	nullable := false
+	if t.Kind() == reflect.Pointer {
+		t, nullable = t.Elem(), true
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return "DATETIME", nullable
+	case reflect.TypeOf(sql.NullString{}):
+		return "VARCHAR(255)", true
+	case reflect.TypeOf(sql.NullInt64{}):
+		return "BIGINT", true
+	case reflect.TypeOf(sql.NullInt32{}):
+		return "INT", true
+	case reflect.TypeOf(sql.NullInt16{}):
+		return "SMALLINT", true
+	case reflect.TypeOf(sql.NullFloat64{}):
+		return "DOUBLE", true
+	case reflect.TypeOf(sql.NullBool{}):
+		return "TINYINT(1)", true
+	case reflect.TypeOf(sql.NullTime{}):
+		return "DATETIME", true
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "VARCHAR(255)", nullable
+	case reflect.Bool:
+		return "TINYINT(1)", nullable
+	case reflect.Int8:
+		return "TINYINT", nullable
+	case reflect.Int16:
+		return "SMALLINT", nullable
+	case reflect.Int32:
+		return "INT", nullable
+	case reflect.Int, reflect.Int64:
+		return "BIGINT", nullable
+	case reflect.Uint8:
+		return "TINYINT UNSIGNED", nullable
+	case reflect.Uint16:
+		return "SMALLINT UNSIGNED", nullable
+	case reflect.Uint32:
+		return "INT UNSIGNED", nullable
+	case reflect.Uint, reflect.Uint64:
+		return "BIGINT UNSIGNED", nullable
+	case reflect.Float32:
+		return "FLOAT", nullable
+	case reflect.Float64:
+		return "DOUBLE", nullable
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BLOB", nullable
+		}
+	}
+	return "", nullable
+}
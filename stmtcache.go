@@ -0,0 +1,118 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// StmtCache keeps prepared statements for reuse across calls, keyed by query
+// text, so hot paths such as repeated Updates of the same shape prepare once.
+// Pass it to a call with the UseStmtCache option. It is safe for concurrent
+// use.
+//
+// Statements are prepared on the cache's *sql.DB. A cached statement can
+// only run in a transaction begun on that same *sql.DB, which database/sql
+// gives no way to check, so calls made on a plain *sql.Tx prepare as usual;
+// wrap the transaction with Tx to use the cache in it. Calls on any other
+// connection prepare as usual too. Every distinct query text is kept until
+// Close, so avoid it for queries whose shape varies, such as inserts of a
+// varying number of rows.
+type StmtCache struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// NewStmtCache returns an empty cache preparing statements on db.
+func NewStmtCache(db *sql.DB) *StmtCache {
+	return &StmtCache{db: db, stmts: map[string]*sql.Stmt{}}
+}
+
+// Len returns the number of cached statements.
+func (c *StmtCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.stmts)
+}
+
+// Close closes every cached statement and empties the cache. It returns the
+// first error encountered; the cache stays usable afterwards.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	stmts := c.stmts
+	c.stmts = map[string]*sql.Stmt{}
+	c.mu.Unlock()
+
+	var first error
+	for _, stmt := range stmts {
+		if err := stmt.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Tx returns tx marked as begun on the cache's *sql.DB, for passing to calls
+// made with UseStmtCache so they run the cached statements in tx through
+// Tx.StmtContext. The result joins tx like tx itself would; a transaction
+// begun on another *sql.DB must not be marked, since the cached statements
+// fail in it.
+func (c *StmtCache) Tx(tx *sql.Tx) Querier {
+	return cacheTx{Tx: tx, cache: c}
+}
+
+// cacheTx is a transaction marked by StmtCache.Tx.
+type cacheTx struct {
+	*sql.Tx
+	cache *StmtCache
+}
+
+// get returns the cached statement for query, preparing it on a miss.
+func (c *StmtCache) get(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	stmt, ok := c.stmts[query]
+	c.mu.Unlock()
+	if ok {
+		return stmt, nil
+	}
+
+	// Prepare without holding the lock so a slow round trip does not block
+	// other queries; if another call won the race, keep its statement.
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.stmts[query]; ok {
+		stmt.Close()
+		return existing, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// stmtFor returns a statement for query usable on db, and whether the caller
+// must close it. It returns a nil statement when db cannot use the cache.
+func (c *StmtCache) stmtFor(ctx context.Context, db Querier, query string) (*sql.Stmt, bool, error) {
+	switch q := db.(type) {
+	case *sql.DB:
+		if q != c.db {
+			return nil, false, nil
+		}
+		stmt, err := c.get(ctx, query)
+		return stmt, false, err
+	case cacheTx:
+		if q.cache != c {
+			return nil, false, nil
+		}
+		stmt, err := c.get(ctx, query)
+		if err != nil {
+			return nil, false, err
+		}
+		return q.StmtContext(ctx, stmt), true, nil
+	}
+	return nil, false, nil
+}
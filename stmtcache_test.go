@@ -0,0 +1,29 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestStmtCacheSkipsUnmarkedTx(t *testing.T) {
+	db := openTestDB(t)
+	c, other := NewStmtCache(db), NewStmtCache(db)
+
+	for _, tt := range []struct {
+		name string
+		db   Querier
+	}{
+		{"plain tx", (*sql.Tx)(nil)},
+		{"tx marked by another cache", other.Tx(nil)},
+		{"another pool", openTestDB(t)},
+	} {
+		stmt, _, err := c.stmtFor(context.Background(), tt.db, "SELECT 1")
+		if stmt != nil || err != nil {
+			t.Errorf("%s: got (%v, %v), want no statement", tt.name, stmt, err)
+		}
+	}
+	if c.Len() != 0 {
+		t.Errorf("cache holds %d statements, want 0", c.Len())
+	}
+}
@@ -0,0 +1,224 @@
+package mysqlutils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SelectInto selects rows from tableName into a slice of structs of type T.
+// Each exported field maps to the column named by its `db` tag, or to the
+// field name when there is no tag; a tag of "-" skips the field and anonymous
+// struct fields are flattened. Use pointer fields for nullable columns: they
+// are set to nil for NULL.
+func SelectInto[T any](db Querier, tableName string, whereClause interface{}, opts ...Option) ([]T, error) {
+	return SelectIntoContext[T](context.Background(), db, tableName, whereClause, opts...)
+}
+
+// SelectIntoContext is like SelectInto but runs the query with the given context.
+func SelectIntoContext[T any](ctx context.Context, db Querier, tableName string, whereClause interface{}, opts ...Option) (result []T, err error) {
+	defer func(start time.Time) { observe(OpSelect, start, int64(len(result)), err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := structFields(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.column
+	}
+
+	o := newOptions(opts)
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	query, args, err := buildSelect(tableName, columns, whereClause, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkLock(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return nil, queryError("select", query, err)
+	}
+	defer rows.Close()
+
+	result = []T{}
+	dest := make([]interface{}, len(fields))
+	for rows.Next() {
+		var item T
+		v := reflect.ValueOf(&item).Elem()
+		for i, f := range fields {
+			dest[i] = v.FieldByIndex(f.index).Addr().Interface()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, queryError("select", query, err)
+		}
+		localizeScanned(dest...)
+		result = append(result, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError("select", query, err)
+	}
+	return result, nil
+}
+
+// structField is a struct field mapped to a column.
+type structField struct {
+	column    string
+	index     []int
+	field     reflect.StructField
+	omitEmpty bool
+}
+
+// structFields lists the column-mapped fields of the struct type t.
+func structFields(t reflect.Type) ([]structField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("mysqlutils: %s is not a struct", t)
+	}
+
+	var fields []structField
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag, hasTag := f.Tag.Lookup("db")
+			if tag == "-" {
+				continue
+			}
+			fieldIndex := append(index[:len(index):len(index)], i)
+			if f.Anonymous && !hasTag && f.Type.Kind() == reflect.Struct {
+				walk(f.Type, fieldIndex)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+
+			column := f.Name
+			name, flags, _ := strings.Cut(tag, ",")
+			if name != "" {
+				column = name
+			}
+			fields = append(fields, structField{
+				column:    column,
+				index:     fieldIndex,
+				field:     f,
+				omitEmpty: flags == "omitempty",
+			})
+		}
+	}
+	walk(t, nil)
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("mysqlutils: %s has no exported fields", t)
+	}
+	return fields, nil
+}
+
+// InsertStructs inserts records, a slice of structs or of pointers to
+// structs, mapping fields to columns as SelectInto does, and returns the
+// number of rows inserted. The rows are sent in batches inside one
+// transaction, as with InsertBatch.
+//
+// By default every mapped field is inserted, zero values included. A field
+// tagged with omitempty, as in `db:"id,omitempty"`, is left out when it holds
+// its zero value, so the column gets its default or AUTO_INCREMENT value
+// instead; the OmitZero option does the same for every field. Records that
+// end up with different columns are inserted in separate statements.
+func InsertStructs(db Querier, tableName string, records interface{}, opts ...Option) (int64, error) {
+	return InsertStructsContext(context.Background(), db, tableName, records, opts...)
+}
+
+// InsertStructsContext is like InsertStructs but runs the statements with the
+// given context.
+func InsertStructsContext(ctx context.Context, db Querier, tableName string, records interface{}, opts ...Option) (int64, error) {
+	o := newOptions(opts)
+	db, err := o.resolveDB(db)
+	if err != nil {
+		return 0, err
+	}
+	groups, err := structRows(records, o.omitZero)
+	if err != nil || len(groups) == 0 {
+		return 0, err
+	}
+
+	var total int64
+	err = o.inTx(ctx, db, func(q Querier) error {
+		for _, rows := range groups {
+			affected, err := InsertBatchContext(ctx, q, tableName, rows, DefaultBatchSize, opts...)
+			if err != nil {
+				return err
+			}
+			total += affected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// structRows converts records into insert rows, grouped by the set of
+// columns they hold so each group can share a multi-row statement. Groups
+// keep the order in which their first record appears.
+func structRows(records interface{}, omitZero bool) ([][]map[string]interface{}, error) {
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("mysqlutils: InsertStructs needs a slice of structs, got %T", records)
+	}
+	elem := v.Type().Elem()
+	ptr := elem.Kind() == reflect.Pointer
+	if ptr {
+		elem = elem.Elem()
+	}
+	fields, err := structFields(elem)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]map[string]interface{}
+	groupOf := map[string]int{}
+	for i := 0; i < v.Len(); i++ {
+		rv := v.Index(i)
+		if ptr {
+			if rv.IsNil() {
+				return nil, fmt.Errorf("mysqlutils: InsertStructs: record %d is nil", i)
+			}
+			rv = rv.Elem()
+		}
+
+		row := make(map[string]interface{}, len(fields))
+		var key strings.Builder
+		for _, f := range fields {
+			fv := rv.FieldByIndex(f.index)
+			if (omitZero || f.omitEmpty) && fv.IsZero() {
+				continue
+			}
+			row[f.column] = fv.Interface()
+			key.WriteString(f.column)
+			key.WriteByte(',')
+		}
+		if len(row) == 0 {
+			return nil, fmt.Errorf("mysqlutils: InsertStructs: record %d has no non-zero fields", i)
+		}
+
+		g, ok := groupOf[key.String()]
+		if !ok {
+			g = len(groups)
+			groupOf[key.String()] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], row)
+	}
+	return groups, nil
+}
@@ -0,0 +1,154 @@
+package mysqlutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Querier is the subset of database/sql methods the package needs. It is
+// satisfied by *sql.DB, *sql.Tx and *sql.Conn, so every function can run
+// either on its own or inside a transaction. Passing a nil Querier uses the
+// connection registered with SetDefaultDB.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// WithTransaction runs fn inside a transaction. The transaction is committed
+// if fn returns nil and rolled back if it returns an error or panics; a panic
+// is re-raised after the rollback.
+func WithTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	return WithTransactionContext(context.Background(), db, nil, fn)
+}
+
+// WithTransactionContext is like WithTransaction but begins the transaction
+// with the given context and options.
+func WithTransactionContext(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	if db == nil {
+		db = DefaultDB()
+		if db == nil {
+			return ErrNoDB
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return runTx(tx, func() error { return fn(tx) })
+}
+
+// runTx calls fn and commits tx if it succeeds, rolling back on error or
+// panic.
+func runTx(tx *sql.Tx, fn func() error) error {
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// txBeginner is implemented by *sql.DB and *sql.Conn.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// inTx runs fn in a new transaction when db can begin one. Otherwise db is
+// assumed to already be a transaction, and fn runs on it directly so the
+// caller keeps control of commit and rollback.
+func inTx(ctx context.Context, db Querier, fn func(q Querier) error) error {
+	b, ok := db.(txBeginner)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := b.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	return runTx(tx, func() error { return fn(tx) })
+}
+
+// Savepoint marks a point in tx that RollbackTo can return to without
+// aborting the whole transaction. Setting a savepoint with an existing name
+// moves it.
+func Savepoint(tx *sql.Tx, name string) error {
+	return SavepointContext(context.Background(), tx, name)
+}
+
+// SavepointContext is like Savepoint but runs the statement with the given
+// context.
+func SavepointContext(ctx context.Context, tx *sql.Tx, name string) error {
+	return savepointExec(ctx, tx, "SAVEPOINT ", name)
+}
+
+// RollbackTo undoes the changes made in tx since the savepoint name was set.
+// The savepoint stays in place, so it can be rolled back to again.
+func RollbackTo(tx *sql.Tx, name string) error {
+	return RollbackToContext(context.Background(), tx, name)
+}
+
+// RollbackToContext is like RollbackTo but runs the statement with the given
+// context.
+func RollbackToContext(ctx context.Context, tx *sql.Tx, name string) error {
+	return savepointExec(ctx, tx, "ROLLBACK TO SAVEPOINT ", name)
+}
+
+// ReleaseSavepoint removes the savepoint name from tx, keeping its changes.
+func ReleaseSavepoint(tx *sql.Tx, name string) error {
+	return ReleaseSavepointContext(context.Background(), tx, name)
+}
+
+// ReleaseSavepointContext is like ReleaseSavepoint but runs the statement
+// with the given context.
+func ReleaseSavepointContext(ctx context.Context, tx *sql.Tx, name string) error {
+	return savepointExec(ctx, tx, "RELEASE SAVEPOINT ", name)
+}
+
+// WithSavepoint runs fn inside tx behind the savepoint name. If fn returns an
+// error, only its changes are rolled back and the error is returned; tx
+// itself stays usable.
+func WithSavepoint(tx *sql.Tx, name string, fn func() error) error {
+	return WithSavepointContext(context.Background(), tx, name, fn)
+}
+
+// WithSavepointContext is like WithSavepoint but runs the savepoint
+// statements with the given context.
+func WithSavepointContext(ctx context.Context, tx *sql.Tx, name string, fn func() error) error {
+	if err := SavepointContext(ctx, tx, name); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if rbErr := RollbackToContext(ctx, tx, name); rbErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return ReleaseSavepointContext(ctx, tx, name)
+}
+
+func savepointExec(ctx context.Context, tx *sql.Tx, stmt, name string) error {
+	if strings.Contains(name, ".") {
+		return fmt.Errorf("%w %q", ErrInvalidIdentifier, name)
+	}
+	if err := checkIdent(name); err != nil {
+		return err
+	}
+
+	query := stmt + quoteName(name)
+	if _, err := execContext(ctx, tx, query); err != nil {
+		return queryError("savepoint", query, err)
+	}
+	return nil
+}
@@ -1,178 +1,1745 @@
 package mysqlutils
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
+// DB_CONN is kept for compatibility only; the package never reads it.
+//
+// Deprecated: pass a connection to each function, or register one with
+// SetDefaultDB.
 var DB_CONN *sql.DB
 
 // Select executes a SELECT query on the specified table using the provided database connection.
+// whereClause accepts any of the forms described on Cond.
 // It returns the result as a slice of maps, where each map represents a row with column names as keys.
+// SQL NULL values are returned as nil, so they can be told apart from empty strings.
+// Options such as OrderBy, Limit, InnerJoin and GroupBy refine the generated query.
+// An empty or nil columns slice selects every column, as does "*"; "orders.*"
+// selects every column of orders, which is useful with joins.
+// tableName may be qualified with a schema, as in "analytics.events", to read
+// from another database on the same connection; columns may then be
+// qualified with both, as in "analytics.events.id".
+func Select(db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []map[string]interface{}, error) {
+	return SelectContext(context.Background(), db, tableName, columns, whereClause, opts...)
+}
+
+// SelectContext is like Select but runs the query with the given context.
+func SelectContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []map[string]interface{}, error) {
+	query, _, result, err := selectRows(ctx, db, tableName, columns, whereClause, opts)
+	return query, result, err
+}
+
+// SelectWithColumns is like Select but also returns the result's column names
+// in the order of the SELECT list, which the row maps cannot preserve. Use it
+// to render rows as a table or CSV.
+func SelectWithColumns(db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []string, []map[string]interface{}, error) {
+	return SelectWithColumnsContext(context.Background(), db, tableName, columns, whereClause, opts...)
+}
+
+// SelectWithColumnsContext is like SelectWithColumns but runs the query with the given context.
+func SelectWithColumnsContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []string, []map[string]interface{}, error) {
+	query, scanner, result, err := selectRows(ctx, db, tableName, columns, whereClause, opts)
+	if err != nil {
+		return query, nil, nil, err
+	}
+	return query, scanner.columnNames, result, nil
+}
+
+// ColumnMeta describes a column of a query result.
+type ColumnMeta struct {
+	Name string
+	// DatabaseType is the MySQL type name in upper case, such as "VARCHAR",
+	// "INT" or "UNSIGNED BIGINT".
+	DatabaseType string
+	Nullable     bool
+	// Length is the declared length of variable-length columns, or 0 when
+	// the driver does not report it; go-sql-driver/mysql never does.
+	Length int64
+	// Precision and Scale are set for DECIMAL columns and for time columns
+	// with fractional seconds.
+	Precision int64
+	Scale     int64
+}
+
+// SelectWithColumnTypes is like SelectWithColumns but describes each result
+// column with its database type, for callers such as generic data grids that
+// format values by type.
+func SelectWithColumnTypes(db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []ColumnMeta, []map[string]interface{}, error) {
+	return SelectWithColumnTypesContext(context.Background(), db, tableName, columns, whereClause, opts...)
+}
+
+// SelectWithColumnTypesContext is like SelectWithColumnTypes but runs the
+// query with the given context.
+func SelectWithColumnTypesContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []ColumnMeta, []map[string]interface{}, error) {
+	query, scanner, result, err := selectRows(ctx, db, tableName, columns, whereClause, opts)
+	if err != nil {
+		return query, nil, nil, err
+	}
+	meta := make([]ColumnMeta, len(scanner.columnTypes))
+	for i, ct := range scanner.columnTypes {
+		m := ColumnMeta{Name: scanner.columnNames[i], DatabaseType: ct.DatabaseTypeName()}
+		m.Nullable, _ = ct.Nullable()
+		m.Length, _ = ct.Length()
+		m.Precision, m.Scale, _ = ct.DecimalSize()
+		meta[i] = m
+	}
+	return query, meta, result, nil
+}
+
+// TypedValue is a result value annotated with the MySQL type of its column,
+// such as "DATETIME", "DECIMAL" or "ENUM", as returned by SelectTyped.
+type TypedValue struct {
+	Value interface{}
+	Type  string
+}
+
+// SelectTyped is like Select but returns each value together with its
+// column's type name, for generic tools that render cells by type.
+func SelectTyped(db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []map[string]TypedValue, error) {
+	return SelectTypedContext(context.Background(), db, tableName, columns, whereClause, opts...)
+}
+
+// SelectTypedContext is like SelectTyped but runs the query with the given
+// context.
+func SelectTypedContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (string, []map[string]TypedValue, error) {
+	query, scanner, result, err := selectRows(ctx, db, tableName, columns, whereClause, opts)
+	if err != nil {
+		return query, nil, err
+	}
+
+	typed := make([]map[string]TypedValue, len(result))
+	for i, row := range result {
+		cells := make(map[string]TypedValue, len(scanner.columnNames))
+		for j, name := range scanner.columnNames {
+			cells[name] = TypedValue{Value: row[name], Type: scanner.columnTypes[j].DatabaseTypeName()}
+		}
+		typed[i] = cells
+	}
+	return query, typed, nil
+}
+
+// selectRows runs a Select and returns the query, the scanner describing the
+// result's columns and its rows.
+func selectRows(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, opts []Option) (query string, scanner *rowScanner, result []map[string]interface{}, err error) {
+	defer func(start time.Time) { observe(OpSelect, start, int64(len(result)), err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	o := newOptions(opts)
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	query, args, err := buildSelect(tableName, columns, whereClause, o)
+	if err != nil {
+		return query, nil, nil, err
+	}
+	if err := o.checkLock(db); err != nil {
+		return query, nil, nil, err
+	}
+
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return query, nil, nil, queryError("select", query, err)
+	}
+	defer rows.Close()
+
+	scanner, result, err = scanRows(rows, o)
+	if err != nil {
+		return query, nil, nil, queryError("select", query, err)
+	}
+
+	return query, scanner, result, nil
+}
+
+// buildSelect renders the SELECT statement and its arguments.
+func buildSelect(tableName string, columns []string, whereClause interface{}, o *options) (string, []interface{}, error) {
+	if len(columns) == 0 && len(o.rawColumns) == 0 {
+		columns = []string{"*"}
+	}
+	if err := checkIdent(tableName); err != nil {
+		return "", nil, err
+	}
+	if err := checkColumns(columns); err != nil {
+		return "", nil, err
+	}
+
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteColumn(col)
+		_, _, aliased := splitAlias(col)
+		_, star := starTable(col)
+		if len(o.joins) > 0 && strings.Contains(col, ".") && !isAggregate(col) && !aliased && !star {
+			quoted[i] += " AS " + quoteName(col)
+		}
+	}
+	query := "SELECT "
+	if ms := o.timeout.Milliseconds(); ms > 0 {
+		// Have the server abort the statement too, in case it keeps
+		// running after the driver gives up on the connection.
+		query += fmt.Sprintf("/*+ MAX_EXECUTION_TIME(%d) */ ", ms)
+	}
+	if o.distinct {
+		query += "DISTINCT "
+	}
+	quoted = append(quoted, o.rawColumns...)
+	query += strings.Join(quoted, ", ") + " FROM " + quoteIdent(tableName)
+
+	joins, err := o.joinClause()
+	if err != nil {
+		return query, nil, err
+	}
+	query += joins
+
+	if len(o.excludeDeleted) > 0 {
+		conds := []interface{}{whereClause}
+		for _, col := range o.excludeDeleted {
+			conds = append(conds, Cond{Column: col, Op: "IS NULL"})
+		}
+		whereClause = And(conds...)
+	}
+
+	where, args, err := buildWhere(whereClause)
+	if err != nil {
+		return query, nil, err
+	}
+	query += where
+
+	groupBy, groupArgs, err := o.groupByClause()
+	if err != nil {
+		return query, nil, err
+	}
+	query += groupBy
+	args = append(args, groupArgs...)
+
+	orderBy, err := o.orderByClause()
+	if err != nil {
+		return query, nil, err
+	}
+	query += orderBy
+
+	limit, limitValues, err := o.limitClause()
+	if err != nil {
+		return query, nil, err
+	}
+	query += limit
+	args = append(args, limitValues...)
+
+	if o.lock != "" {
+		query += " " + o.lock
+	}
+	return query, args, nil
+}
+
+// SelectEach runs the same query as Select but calls fn for each row as it is
+// read instead of collecting them, so memory use does not grow with the
+// result size. Iteration stops at the first error returned by fn, which
+// SelectEach then returns unchanged.
+func SelectEach(db Querier, tableName string, columns []string, whereClause interface{}, fn func(row map[string]interface{}) error, opts ...Option) error {
+	return SelectEachContext(context.Background(), db, tableName, columns, whereClause, fn, opts...)
+}
+
+// SelectEachContext is like SelectEach but runs the query with the given context.
+func SelectEachContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, fn func(row map[string]interface{}) error, opts ...Option) (err error) {
+	var count int64
+	defer func(start time.Time) { observe(OpSelect, start, count, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return err
+	}
+	o := newOptions(opts)
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	query, args, err := buildSelect(tableName, columns, whereClause, o)
+	if err != nil {
+		return err
+	}
+	if err := o.checkLock(db); err != nil {
+		return err
+	}
+
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return queryError("select", query, err)
+	}
+	defer rows.Close()
+
+	scanner, err := newRowScanner(rows, o)
+	if err != nil {
+		return queryError("select", query, err)
+	}
+	for rows.Next() {
+		row, err := scanner.scan()
+		if err != nil {
+			return queryError("select", query, err)
+		}
+		count++
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return queryError("select", query, err)
+	}
+	return nil
+}
+
+// SelectMapBy runs the same query as Select and returns the rows indexed by
+// the value of keyColumn, which must be among the selected columns and
+// should be unique. A key shared by two rows is an error rather than one row
+// silently replacing the other. Binary keys returned by the BinaryBytes
+// option are converted to strings, since []byte cannot be a map key.
+func SelectMapBy(db Querier, tableName string, columns []string, whereClause interface{}, keyColumn string, opts ...Option) (map[interface{}]map[string]interface{}, error) {
+	return SelectMapByContext(context.Background(), db, tableName, columns, whereClause, keyColumn, opts...)
+}
+
+// SelectMapByContext is like SelectMapBy but runs the query with the given
+// context.
+func SelectMapByContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, keyColumn string, opts ...Option) (map[interface{}]map[string]interface{}, error) {
+	query, _, rows, err := selectRows(ctx, db, tableName, columns, whereClause, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resultKey := newOptions(opts).resultKey(keyColumn)
+	byKey := make(map[interface{}]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		key, ok := batchKeyValue(row, resultKey)
+		if !ok {
+			return nil, fmt.Errorf("mysqlutils: key column %s is not among the selected columns", keyColumn)
+		}
+		if b, isBytes := key.([]byte); isBytes {
+			key = string(b)
+		}
+		if _, dup := byKey[key]; dup {
+			return nil, fmt.Errorf("mysqlutils: duplicate %s %v in result of %q", keyColumn, key, query)
+		}
+		byKey[key] = row
+	}
+	return byKey, nil
+}
+
+// SelectBatches runs the same query as Select in pages of batchSize rows,
+// calling fn with each page until the rows run out or fn returns an error,
+// which is then returned. Without the BatchKey option pages are read with
+// LIMIT and OFFSET, in the order given by OrderBy; pass an OrderBy on a
+// unique column so no row is skipped or repeated. For large tables prefer
+// BatchKey, which avoids OFFSET.
+func SelectBatches(db Querier, tableName string, columns []string, whereClause interface{}, batchSize int, fn func(batch []map[string]interface{}) error, opts ...Option) error {
+	return SelectBatchesContext(context.Background(), db, tableName, columns, whereClause, batchSize, fn, opts...)
+}
+
+// SelectBatchesContext is like SelectBatches but runs the queries with the
+// given context.
+func SelectBatchesContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, batchSize int, fn func(batch []map[string]interface{}) error, opts ...Option) (err error) {
+	var count int64
+	defer func(start time.Time) { observe(OpSelect, start, count, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return err
+	}
+	if batchSize <= 0 {
+		return fmt.Errorf("mysqlutils: batch size must be positive, got %d", batchSize)
+	}
+	o := newOptions(opts)
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+
+	page := *o
+	page.limit = batchSize
+	key := o.batchKey
+	if key != "" {
+		page.orderBy = []orderTerm{{column: key, direction: "ASC"}}
+		page.offset = 0
+	}
+
+	if err := o.checkLock(db); err != nil {
+		return err
+	}
+
+	where := whereClause
+	for {
+		query, args, err := buildSelect(tableName, columns, where, &page)
+		if err != nil {
+			return err
+		}
+		rows, err := queryContext(ctx, db, query, args...)
+		if err != nil {
+			return queryError("select", query, err)
+		}
+		_, batch, err := scanRows(rows, &page)
+		rows.Close()
+		if err != nil {
+			return queryError("select", query, err)
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+		count += int64(len(batch))
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+
+		if key == "" {
+			page.offset += batchSize
+			continue
+		}
+		last, ok := batchKeyValue(batch[len(batch)-1], o.resultKey(key))
+		if !ok {
+			return fmt.Errorf("mysqlutils: batch key %s is not among the selected columns", key)
+		}
+		where = And(whereClause, Cond{Column: key, Op: ">", Value: last})
+	}
+}
+
+// batchKeyValue returns the value of the key column in row, which is keyed by
+// the bare column name unless the query has joins.
+func batchKeyValue(row map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := row[key]; ok {
+		return v, true
+	}
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		v, ok := row[key[i+1:]]
+		return v, ok
+	}
+	return nil, false
+}
+
+// SelectOne is like Select but expects exactly one matching row. It returns
+// ErrNoRows when nothing matches and ErrTooManyRows when several rows do.
+func SelectOne(db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (map[string]interface{}, error) {
+	return SelectOneContext(context.Background(), db, tableName, columns, whereClause, opts...)
+}
+
+// SelectOneContext is like SelectOne but runs the query with the given context.
+func SelectOneContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, opts ...Option) (map[string]interface{}, error) {
+	// Two rows are enough to tell a unique match from an ambiguous one.
+	opts = append(opts[:len(opts):len(opts)], Limit(2))
+	_, rows, err := SelectContext(ctx, db, tableName, columns, whereClause, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(rows) {
+	case 0:
+		return nil, ErrNoRows
+	case 1:
+		return rows[0], nil
+	}
+	return nil, ErrTooManyRows
+}
+
+// Count returns the number of rows in tableName matching whereClause, using
+// the same equality semantics as Select.
+func Count(db Querier, tableName string, whereClause interface{}) (string, int64, error) {
+	return CountContext(context.Background(), db, tableName, whereClause)
+}
+
+// CountContext is like Count but runs the query with the given context.
+func CountContext(ctx context.Context, db Querier, tableName string, whereClause interface{}) (query string, count int64, err error) {
+	defer func(start time.Time) {
+		var rows int64
+		if err == nil {
+			rows = 1 // The single row holding the count.
+		}
+		observe(OpSelect, start, rows, err)
+	}(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := checkIdent(tableName); err != nil {
+		return "", 0, err
+	}
+
+	query = "SELECT COUNT(*) FROM " + quoteIdent(tableName)
+	where, whereValues, err := buildWhere(whereClause)
+	if err != nil {
+		return query, 0, err
+	}
+	query += where
+
+	if err := queryRowScan(ctx, db, query, whereValues, &count); err != nil {
+		return query, 0, queryError("count", query, err)
+	}
+	return query, count, nil
+}
+
+// Exists reports whether any row in tableName matches whereClause. It stops
+// at the first match instead of counting every row.
+func Exists(db Querier, tableName string, whereClause interface{}) (bool, error) {
+	return ExistsContext(context.Background(), db, tableName, whereClause)
+}
+
+// ExistsContext is like Exists but runs the query with the given context.
+func ExistsContext(ctx context.Context, db Querier, tableName string, whereClause interface{}) (exists bool, err error) {
+	defer func(start time.Time) {
+		var rows int64
+		if exists {
+			rows = 1
+		}
+		observe(OpSelect, start, rows, err)
+	}(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return false, err
+	}
+	if err := checkIdent(tableName); err != nil {
+		return false, err
+	}
+
+	query := "SELECT 1 FROM " + quoteIdent(tableName)
+	where, whereValues, err := buildWhere(whereClause)
+	if err != nil {
+		return false, err
+	}
+	query += where + " LIMIT 1"
+
+	var one int
+	err = queryRowScan(ctx, db, query, whereValues, &one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, queryError("exists", query, err)
+	}
+	return true, nil
+}
+
+// Paginate returns page number page (counting from 1) of the rows Select
+// would return, pageSize rows at a time, along with the total number of
+// matching rows across all pages. The two queries run in one transaction so
+// the total agrees with the page. opts apply to both queries, except that
+// ordering and limits only apply to the page; pass an OrderBy so pages come
+// back in a stable order.
+func Paginate(db Querier, tableName string, columns []string, whereClause interface{}, page, pageSize int, opts ...Option) (rows []map[string]interface{}, total int64, err error) {
+	return PaginateContext(context.Background(), db, tableName, columns, whereClause, page, pageSize, opts...)
+}
+
+// PaginateContext is like Paginate but runs the queries with the given
+// context.
+func PaginateContext(ctx context.Context, db Querier, tableName string, columns []string, whereClause interface{}, page, pageSize int, opts ...Option) (rows []map[string]interface{}, total int64, err error) {
+	db, err = resolveDB(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	if pageSize <= 0 {
+		return nil, 0, fmt.Errorf("mysqlutils: page size must be positive, got %d", pageSize)
+	}
+	if page < 1 {
+		page = 1
+	}
+	o := newOptions(opts)
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+
+	// Count every row of the unpaged query. Selecting a constant keeps
+	// joined columns from clashing inside the derived table.
+	counted := *o
+	counted.orderBy, counted.limit, counted.offset, counted.timeout, counted.lock = nil, 0, 0, 0, ""
+	countColumns := columns
+	if !o.distinct {
+		countColumns, counted.rawColumns = nil, []string{"1"}
+	}
+	inner, args, err := buildSelect(tableName, countColumns, whereClause, &counted)
+	if err != nil {
+		return nil, 0, err
+	}
+	countQuery := "SELECT COUNT(*) FROM (" + inner + ") AS `counted`"
+
+	pageOpts := append(opts[:len(opts):len(opts)], Limit(pageSize), Offset((page-1)*pageSize))
+	err = inTx(ctx, db, func(q Querier) error {
+		if err := queryRowScan(ctx, q, countQuery, args, &total); err != nil {
+			return queryError("count", countQuery, err)
+		}
+		_, _, rows, err = selectRows(ctx, q, tableName, columns, whereClause, pageOpts)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+// Insert inserts multiple rows into a table and returns the last insert ID
+// and the number of rows inserted. For multi-row inserts MySQL reports the ID
+// generated for the first row, and tables without an AUTO_INCREMENT column
+// report 0. Columns appear in the query sorted by name. A nil value, a nil
+// pointer such as (*string)(nil) and an invalid sql.Null* value all insert
+// NULL.
+func Insert(db Querier, tableName string, data []map[string]interface{}, opts ...Option) (query string, lastID, rowsAffected int64, err error) {
+	return InsertContext(context.Background(), db, tableName, data, opts...)
+}
+
+// InsertContext is like Insert but runs the statement with the given context.
+func InsertContext(ctx context.Context, db Querier, tableName string, data []map[string]interface{}, opts ...Option) (query string, lastID, rowsAffected int64, err error) {
+	return insertRows(ctx, db, "INSERT INTO", tableName, data, newOptions(opts))
+}
+
+// InsertIgnore is like Insert but uses INSERT IGNORE INTO, so rows that would
+// duplicate an existing primary or unique key are skipped instead of failing
+// the statement. rowsAffected counts only the rows actually inserted. Note
+// that IGNORE also downgrades other errors, such as out-of-range values, to
+// warnings.
+func InsertIgnore(db Querier, tableName string, data []map[string]interface{}, opts ...Option) (query string, lastID, rowsAffected int64, err error) {
+	return InsertIgnoreContext(context.Background(), db, tableName, data, opts...)
+}
+
+// InsertIgnoreContext is like InsertIgnore but runs the statement with the
+// given context.
+func InsertIgnoreContext(ctx context.Context, db Querier, tableName string, data []map[string]interface{}, opts ...Option) (query string, lastID, rowsAffected int64, err error) {
+	return insertRows(ctx, db, "INSERT IGNORE INTO", tableName, data, newOptions(opts))
+}
+
+// Replace is like Insert but uses REPLACE INTO: a row that conflicts with an
+// existing one on a primary or unique key replaces it. MySQL does this by
+// deleting the old row and inserting the new one, so delete triggers fire,
+// foreign keys with ON DELETE actions apply and the row gets a new
+// AUTO_INCREMENT value. Use Upsert to update the existing row in place
+// instead. MySQL counts a replaced row as two affected rows, one deleted and
+// one inserted.
+func Replace(db Querier, tableName string, data []map[string]interface{}, opts ...Option) (query string, lastID, rowsAffected int64, err error) {
+	return ReplaceContext(context.Background(), db, tableName, data, opts...)
+}
+
+// ReplaceContext is like Replace but runs the statement with the given context.
+func ReplaceContext(ctx context.Context, db Querier, tableName string, data []map[string]interface{}, opts ...Option) (query string, lastID, rowsAffected int64, err error) {
+	return insertRows(ctx, db, "REPLACE INTO", tableName, data, newOptions(opts))
+}
+
+// insertRows runs a multi-row INSERT-style statement starting with verb and
+// returns the last insert ID and the number of rows affected.
+func insertRows(ctx context.Context, db Querier, verb, tableName string, data []map[string]interface{}, o *options) (query string, lastID, affected int64, err error) {
+	defer func(start time.Time) { o.observe(OpInsert, start, affected, err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if len(data) == 0 {
+		return "", 0, 0, nil // Nothing to insert
+	}
+	data, err = o.insertData(data)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	query, _, values, err := buildInsert(verb, tableName, data)
+	if err != nil {
+		return query, 0, 0, err
+	}
+
+	op := strings.ToLower(strings.Fields(verb)[0])
+	result, err := o.exec(ctx, db, query, values...)
+	if err != nil {
+		return query, 0, 0, queryError(op, query, err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return query, 0, 0, queryError(op, query, err)
+	}
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return query, 0, 0, queryError(op, query, err)
+	}
+	return query, id, affected, nil
+}
+
+// InsertSelect copies rows into destTable from the result of selectQuery,
+// running INSERT INTO destTable (columns) selectQuery with args bound to the
+// query's placeholders. selectQuery can be written by hand or come from
+// BuildSelect. The SELECT must return exactly as many columns as columns
+// lists, in the same order; with no columns, it must match every column of
+// destTable in table order. It returns the number of rows inserted.
+func InsertSelect(db Querier, destTable string, columns []string, selectQuery string, args ...interface{}) (string, int64, error) {
+	return InsertSelectContext(context.Background(), db, destTable, columns, selectQuery, args...)
+}
+
+// InsertSelectContext is like InsertSelect but runs the statement with the given context.
+func InsertSelectContext(ctx context.Context, db Querier, destTable string, columns []string, selectQuery string, args ...interface{}) (query string, affected int64, err error) {
+	defer func(start time.Time) { observe(OpInsert, start, affected, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := checkIdent(destTable); err != nil {
+		return "", 0, err
+	}
+	if err := checkIdent(columns...); err != nil {
+		return "", 0, err
+	}
+
+	query = "INSERT INTO " + quoteIdent(destTable)
+	if len(columns) > 0 {
+		query += " (" + strings.Join(quoteIdents(columns), ", ") + ")"
+	}
+	query += " " + selectQuery
+
+	result, err := execContext(ctx, db, query, args...)
+	if err != nil {
+		return query, 0, queryError("insert select", query, err)
+	}
+
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return query, 0, queryError("insert select", query, err)
+	}
+	return query, affected, nil
+}
+
+// DefaultBatchSize is the number of rows InsertBatch sends per statement when
+// no batch size is given.
+const DefaultBatchSize = 1000
+
+// InsertBatch inserts data in chunks of batchSize rows, one INSERT statement
+// per chunk, so large loads stay under max_allowed_packet. A batchSize of 0
+// or less uses DefaultBatchSize. Chunks are made smaller when needed to keep
+// each statement within MySQL's limit of 65,535 placeholders, so wide tables
+// work with the default too. The chunks run in a single transaction, so
+// either every row is inserted or none is; when db is already a *sql.Tx the
+// chunks join it instead. It returns the total number of rows affected.
+func InsertBatch(db Querier, tableName string, data []map[string]interface{}, batchSize int, opts ...Option) (int64, error) {
+	return InsertBatchContext(context.Background(), db, tableName, data, batchSize, opts...)
+}
+
+// InsertBatchContext is like InsertBatch but runs the statements with the given context.
+func InsertBatchContext(ctx context.Context, db Querier, tableName string, data []map[string]interface{}, batchSize int, opts ...Option) (total int64, err error) {
+	o := newOptions(opts)
+	defer func(start time.Time) { o.observe(OpInsert, start, total, err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	data, err = o.insertData(data)
+	if err != nil {
+		return 0, err
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	batchSize = rowsPerStatement(batchSize, len(data[0]))
+
+	err = o.inTx(ctx, db, func(q Querier) error {
+		for start := 0; start < len(data); start += batchSize {
+			end := start + batchSize
+			if end > len(data) {
+				end = len(data)
+			}
+
+			query, _, values, err := buildInsert("INSERT INTO", tableName, data[start:end])
+			if err != nil {
+				return err
+			}
+			op := fmt.Sprintf("insert batch at row %d", start)
+			result, err := o.exec(ctx, q, query, values...)
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			total += affected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// InsertReturningIDs is like InsertBatch but returns the AUTO_INCREMENT ID
+// generated for each row, aligned with data. MySQL only reports the first ID
+// of each statement, so the rest are derived from it, the row count and
+// auto_increment_increment. That relies on each statement getting
+// consecutive IDs, which InnoDB guarantees with innodb_autoinc_lock_mode 0 or
+// 1; with 2, the default since MySQL 8.0, concurrent inserts into the same
+// table may interleave IDs, and the derived ones can be wrong. Rows must not
+// set the AUTO_INCREMENT column themselves.
+func InsertReturningIDs(db Querier, tableName string, data []map[string]interface{}, batchSize int, opts ...Option) ([]int64, error) {
+	return InsertReturningIDsContext(context.Background(), db, tableName, data, batchSize, opts...)
+}
+
+// InsertReturningIDsContext is like InsertReturningIDs but runs the
+// statements with the given context.
+func InsertReturningIDsContext(ctx context.Context, db Querier, tableName string, data []map[string]interface{}, batchSize int, opts ...Option) (ids []int64, err error) {
+	o := newOptions(opts)
+	defer func(start time.Time) { o.observe(OpInsert, start, int64(len(ids)), err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return []int64{}, nil
+	}
+	data, err = o.insertData(data)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	batchSize = rowsPerStatement(batchSize, len(data[0]))
+
+	ids = make([]int64, 0, len(data))
+	err = o.inTx(ctx, db, func(q Querier) error {
+		var step int64
+		const stepQuery = "SELECT @@SESSION.auto_increment_increment"
+		if o.dryRun == nil {
+			if err := queryRowScan(ctx, q, stepQuery, nil, &step); err != nil {
+				return queryError("insert", stepQuery, err)
+			}
+		}
+
+		for start := 0; start < len(data); start += batchSize {
+			end := start + batchSize
+			if end > len(data) {
+				end = len(data)
+			}
+
+			query, _, values, err := buildInsert("INSERT INTO", tableName, data[start:end])
+			if err != nil {
+				return err
+			}
+			op := fmt.Sprintf("insert batch at row %d", start)
+			result, err := o.exec(ctx, q, query, values...)
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			if o.dryRun != nil {
+				ids = append(ids, make([]int64, end-start)...)
+				continue
+			}
+			first, err := result.LastInsertId()
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			if first == 0 || affected != int64(end-start) {
+				return fmt.Errorf("mysqlutils: %s: got first ID %d for %d of %d rows; cannot derive IDs", op, first, affected, end-start)
+			}
+			for i := int64(0); i < affected; i++ {
+				ids = append(ids, first+i*step)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// buildInsert renders a multi-row INSERT-style statement starting with verb.
+// The columns are taken from the first row and sorted by name so the query is
+// the same on every call; they are returned in query order. Every row must
+// have exactly the same keys as the first one.
+func buildInsert(verb, tableName string, data []map[string]interface{}) (string, []string, []interface{}, error) {
+	columns := sortedKeys(data[0])
+	if err := checkIdent(tableName); err != nil {
+		return "", nil, nil, err
+	}
+	if err := checkIdent(columns...); err != nil {
+		return "", nil, nil, err
+	}
+
+	var values []interface{}
+	query := fmt.Sprintf("%s %s (%s) VALUES", verb, quoteIdent(tableName), strings.Join(quoteIdents(columns), ", "))
+
+	rowsValues := make([]string, 0, len(data))
+	for n, row := range data {
+		if err := checkRowColumns(row, columns); err != nil {
+			return query, nil, nil, fmt.Errorf("mysqlutils: %s %s: row %d: %w", verb, tableName, n, err)
+		}
+		rowValues := make([]string, len(columns))
+		for i, col := range columns {
+			values = append(values, bindValue(row[col]))
+			rowValues[i] = "?"
+		}
+		rowsValues = append(rowsValues, fmt.Sprintf("(%s)", strings.Join(rowValues, ", ")))
+	}
+
+	query += strings.Join(rowsValues, ", ")
+	return query, columns, values, nil
+}
+
+// checkRowColumns reports an error unless row has exactly the given keys.
+func checkRowColumns(row map[string]interface{}, columns []string) error {
+	for _, col := range columns {
+		if _, ok := row[col]; !ok {
+			return fmt.Errorf("missing column %s", col)
+		}
+	}
+	if len(row) != len(columns) {
+		// Every expected column is present, so the remaining keys are extra.
+		extra := []string{}
+		for key := range row {
+			if i := sort.SearchStrings(columns, key); i == len(columns) || columns[i] != key {
+				extra = append(extra, key)
+			}
+		}
+		sort.Strings(extra)
+		return fmt.Errorf("unexpected columns %s", strings.Join(extra, ", "))
+	}
+	return nil
+}
+
+// Upsert inserts rows, updating updateColumns of any existing row that
+// conflicts on a primary or unique key, using INSERT ... ON DUPLICATE KEY
+// UPDATE. When updateColumns is empty every inserted column that is not part
+// of a primary or unique key is updated; the key columns are looked up in
+// information_schema, which costs an extra query. It returns the rows
+// affected as reported by MySQL: 1 per inserted row and 2 per updated row.
+// Use the UpsertIf option to update existing rows only when a condition holds.
+func Upsert(db Querier, tableName string, data []map[string]interface{}, updateColumns []string, opts ...Option) (string, int64, error) {
+	return UpsertContext(context.Background(), db, tableName, data, updateColumns, opts...)
+}
 
-func Select(db *sql.DB, tableName string, columns []string, whereClause map[string]interface{}) (string, []map[string]interface{}, error) {
-	query := "SELECT " + strings.Join(columns, ", ") + " FROM " + tableName
+// UpsertContext is like Upsert but runs the statements with the given context.
+func UpsertContext(ctx context.Context, db Querier, tableName string, data []map[string]interface{}, updateColumns []string, opts ...Option) (query string, affected int64, err error) {
+	o := newOptions(opts)
+	defer func(start time.Time) { o.observe(OpInsert, start, affected, err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(data) == 0 {
+		return "", 0, nil
+	}
+	data, err = o.encodeJSONRows(data)
+	if err != nil {
+		return "", 0, err
+	}
 
-	// Prepare the WHERE clause if it exists
-	var whereValues []interface{}
-	if len(whereClause) > 0 {
-		whereConditions := []string{}
-		for key, value := range whereClause {
-			whereConditions = append(whereConditions, fmt.Sprintf("%s = ?", key))
-			whereValues = append(whereValues, value)
-		}
-		query += " WHERE " + strings.Join(whereConditions, " AND ")
+	query, columns, values, err := buildInsert("INSERT INTO", tableName, data)
+	if err != nil {
+		return query, 0, err
 	}
 
-	rows, err := db.Query(query, whereValues...)
+	onDuplicate, err := upsertClause(ctx, db, tableName, columns, updateColumns, o)
 	if err != nil {
-		return query, nil, err
+		return query, 0, err
 	}
-	defer rows.Close()
+	query += onDuplicate
 
-	columnNames, err := rows.Columns()
+	result, err := o.exec(ctx, db, query, values...)
 	if err != nil {
-		return query, nil, err
+		return query, 0, queryError("upsert", query, err)
 	}
 
-	result := []map[string]interface{}{}
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return query, 0, queryError("upsert", query, err)
+	}
+	return query, affected, nil
+}
 
-	for rows.Next() {
-		columnPointers := make([]interface{}, len(columnNames))
-		columnValues := make([]interface{}, len(columnNames))
+// UpsertBatch is like Upsert but splits data into statements of at most
+// batchSize rows, keeping each one under the server's packet limit, and runs
+// them in a single transaction as InsertBatch does. A batchSize of 0 or less
+// uses DefaultBatchSize, and chunks are made smaller as for InsertBatch to
+// stay within the placeholder limit. It returns the total rows affected,
+// counted as for Upsert, and does nothing when data is empty.
+func UpsertBatch(db Querier, tableName string, data []map[string]interface{}, updateColumns []string, batchSize int, opts ...Option) (int64, error) {
+	return UpsertBatchContext(context.Background(), db, tableName, data, updateColumns, batchSize, opts...)
+}
+
+// UpsertBatchContext is like UpsertBatch but runs the statements with the
+// given context.
+func UpsertBatchContext(ctx context.Context, db Querier, tableName string, data []map[string]interface{}, updateColumns []string, batchSize int, opts ...Option) (total int64, err error) {
+	o := newOptions(opts)
+	defer func(start time.Time) { o.observe(OpInsert, start, total, err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	batchSize = rowsPerStatement(batchSize, len(data[0]))
+	data, err = o.encodeJSONRows(data)
+	if err != nil {
+		return 0, err
+	}
+
+	// Every chunk has the same columns, so the ON DUPLICATE KEY UPDATE
+	// clause, and the key lookup behind it, is only needed once.
+	_, columns, _, err := buildInsert("INSERT INTO", tableName, data[:1])
+	if err != nil {
+		return 0, err
+	}
+	onDuplicate, err := upsertClause(ctx, db, tableName, columns, updateColumns, o)
+	if err != nil {
+		return 0, err
+	}
+
+	err = o.inTx(ctx, db, func(q Querier) error {
+		for start := 0; start < len(data); start += batchSize {
+			end := start + batchSize
+			if end > len(data) {
+				end = len(data)
+			}
 
-		for i := range columnValues {
-			columnPointers[i] = &columnValues[i]
+			query, _, values, err := buildInsert("INSERT INTO", tableName, data[start:end])
+			if err != nil {
+				return err
+			}
+			query += onDuplicate
+			op := fmt.Sprintf("upsert batch at row %d", start)
+			result, err := o.exec(ctx, q, query, values...)
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			total += affected
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
 
-		err := rows.Scan(columnPointers...)
+// upsertClause renders the ON DUPLICATE KEY UPDATE clause for an upsert of
+// columns. With no updateColumns, the columns outside any primary or unique
+// key are updated.
+func upsertClause(ctx context.Context, db Querier, tableName string, columns, updateColumns []string, o *options) (string, error) {
+	if len(updateColumns) == 0 {
+		if db == nil {
+			// Only possible under DryRun, which needs no connection.
+			return "", fmt.Errorf("mysqlutils: upsert into %s without a connection needs updateColumns", tableName)
+		}
+		keys, err := uniqueKeyColumns(ctx, db, tableName)
 		if err != nil {
-			return query, nil, err
+			return "", err
 		}
-
-		rowData := make(map[string]interface{})
-		for i, name := range columnNames {
-			switch v := columnValues[i].(type) {
-			case []byte:
-				rowData[name] = string(v)
-			default:
-				rowData[name] = v
+		for _, col := range columns {
+			if !keys[col] {
+				updateColumns = append(updateColumns, col)
 			}
 		}
+	}
+	if len(updateColumns) == 0 {
+		return "", fmt.Errorf("mysqlutils: upsert into %s has no non-key columns to update", tableName)
+	}
+
+	if err := checkIdent(updateColumns...); err != nil {
+		return "", err
+	}
+
+	assignments, err := upsertAssignments(updateColumns, o.upsertIf)
+	if err != nil {
+		return "", err
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", "), nil
+}
+
+// upsertAssignments renders the ON DUPLICATE KEY UPDATE assignments for
+// columns, guarded by conds when there are any.
+func upsertAssignments(columns []string, conds []Cond) ([]string, error) {
+	if len(conds) == 0 {
+		assignments := make([]string, len(columns))
+		for i, col := range columns {
+			assignments[i] = fmt.Sprintf("%s = VALUES(%s)", quoteIdent(col), quoteIdent(col))
+		}
+		return assignments, nil
+	}
+
+	if len(conds) > 1 {
+		return nil, fmt.Errorf("mysqlutils: Upsert takes at most one UpsertIf, got %d", len(conds))
+	}
+	c := conds[0]
+	if err := checkIdent(c.Column); err != nil {
+		return nil, err
+	}
+	switch c.Op {
+	case "=", "!=", "<>", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("mysqlutils: unsupported UpsertIf operator %q", c.Op)
+	}
+	g := quoteIdent(c.Column)
+	guard := fmt.Sprintf("(%s IS NULL OR VALUES(%s) %s %s)", g, g, c.Op, g)
+
+	// MySQL applies the assignments left to right, and later ones see the
+	// values set by earlier ones. Assign the guarded column last so the
+	// guard is evaluated against the row as it was.
+	ordered := make([]string, 0, len(columns))
+	guarded := false
+	for _, col := range columns {
+		if col == c.Column {
+			guarded = true
+			continue
+		}
+		ordered = append(ordered, col)
+	}
+	if guarded {
+		ordered = append(ordered, c.Column)
+	}
+
+	assignments := make([]string, len(ordered))
+	for i, col := range ordered {
+		q := quoteIdent(col)
+		assignments[i] = fmt.Sprintf("%s = IF(%s, VALUES(%s), %s)", q, guard, q, q)
+	}
+	return assignments, nil
+}
+
+// uniqueKeyColumns returns the columns of tableName that belong to a primary
+// or unique index. tableName may be qualified with a schema name.
+func uniqueKeyColumns(ctx context.Context, db Querier, tableName string) (map[string]bool, error) {
+	filter, args := tableFilter(tableName)
+	query := "SELECT COLUMN_NAME FROM information_schema.STATISTICS WHERE " + filter + " AND NON_UNIQUE = 0"
 
-		result = append(result, rowData)
+	rows, err := queryContext(ctx, db, query, args...)
+	if err != nil {
+		return nil, queryError("look up keys", query, err)
 	}
+	defer rows.Close()
 
+	keys := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, queryError("look up keys", query, err)
+		}
+		keys[name] = true
+	}
 	if err := rows.Err(); err != nil {
-		return query, nil, err
+		return nil, queryError("look up keys", query, err)
 	}
+	return keys, nil
+}
+
+// Update updates multiple rows in a table based on the provided data and WHERE conditions.
+// A data value may be Incr(n) to add to the current value, or a Raw expression.
+// where accepts any of the forms described on Cond and must not be empty; otherwise
+// ErrNoWhere is returned without running anything. It returns the number of rows
+// changed; MySQL does not count rows whose values were already up to date.
+//
+// Conditions with operators make optimistic locking straightforward: the
+// update below only succeeds, with 1 row affected, if nobody else has bumped
+// the version since it was read.
+//
+//	Update(db, "docs", map[string]interface{}{"body": body, "version": v + 1},
+//		[]Cond{{"id", "=", id}, {"version", "=", v}})
+func Update(db Querier, table string, data map[string]interface{}, where interface{}, opts ...Option) (string, int64, error) {
+	return UpdateContext(context.Background(), db, table, data, where, opts...)
+}
 
-	return query, result, nil
+// UpdateContext is like Update but runs the statement with the given context.
+func UpdateContext(ctx context.Context, db Querier, table string, data map[string]interface{}, where interface{}, opts ...Option) (string, int64, error) {
+	return update(ctx, db, table, data, where, false, newOptions(opts))
 }
 
-// Insert inserts multiple rows into a table.
-func Insert(db *sql.DB, tableName string, data []map[string]interface{}) (string, error) {
-	var query = ``
-	if len(data) == 0 {
-		return query, nil // Nothing to insert
+// UpdateAll sets data on every row of table. Unlike Update it needs no WHERE
+// conditions, so use it only when a full-table update is intended.
+func UpdateAll(db Querier, table string, data map[string]interface{}, opts ...Option) (string, int64, error) {
+	return UpdateAllContext(context.Background(), db, table, data, opts...)
+}
+
+// UpdateAllContext is like UpdateAll but runs the statement with the given context.
+func UpdateAllContext(ctx context.Context, db Querier, table string, data map[string]interface{}, opts ...Option) (string, int64, error) {
+	return update(ctx, db, table, data, nil, true, newOptions(opts))
+}
+
+func update(ctx context.Context, db Querier, table string, data map[string]interface{}, where interface{}, all bool, o *options) (query string, affected int64, err error) {
+	defer func(start time.Time) { o.observe(OpUpdate, start, affected, err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return "", 0, err
+	}
+	data, err = o.encodeJSON(o.stampUpdated(data))
+	if err != nil {
+		return "", 0, err
+	}
+	query, values, err := buildUpdate(table, data, where, all)
+	if err != nil {
+		return query, 0, err
+	}
+	if o.dryRun != nil {
+		o.dryRun(query, values)
+		return query, 0, nil
 	}
 
-	columns := make([]string, 0, len(data[0]))
-	for key := range data[0] {
-		columns = append(columns, key)
+	stmt, owned, err := o.prepare(ctx, db, query)
+	if err != nil {
+		return query, 0, queryError("update", query, err)
+	}
+	if owned {
+		defer stmt.Close()
+	}
+	result, err := stmtExecContext(ctx, stmt, query, values...)
+	if err != nil {
+		return query, 0, queryError("update", query, err)
 	}
 
-	placeholders := make([]string, len(columns))
-	for i := range placeholders {
-		placeholders[i] = "?"
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return query, 0, queryError("update", query, err)
 	}
+	return query, affected, nil
+}
 
-	var values []interface{}
-	query = fmt.Sprintf("INSERT INTO %s (%s) VALUES", tableName, strings.Join(columns, ", "))
+// UpdateReturning emulates UPDATE ... RETURNING, which MySQL lacks: it
+// updates the rows matching where and returns their columns as they are
+// after the update, as Select would. It needs a transaction because it runs
+// three statements: it first locks the matching rows with SELECT ... FOR
+// UPDATE and notes their primary keys, then updates and re-reads exactly
+// those rows by key. Locking keeps other transactions from changing the rows
+// in between, and going by key means the result is right even when data
+// changes the columns that where tests. The table must have a primary key,
+// and data must not change it. Like Update, it returns ErrNoWhere for an empty where.
+func UpdateReturning(tx *sql.Tx, table string, data map[string]interface{}, where interface{}, columns []string, opts ...Option) ([]map[string]interface{}, error) {
+	return UpdateReturningContext(context.Background(), tx, table, data, where, columns, opts...)
+}
 
-	rowsValues := make([]string, 0, len(data))
-	for _, row := range data {
-		rowValues := make([]string, len(columns))
-		for i, col := range columns {
-			values = append(values, row[col])
-			rowValues[i] = "?"
+// UpdateReturningContext is like UpdateReturning but runs the statements with
+// the given context.
+func UpdateReturningContext(ctx context.Context, tx *sql.Tx, table string, data map[string]interface{}, where interface{}, columns []string, opts ...Option) ([]map[string]interface{}, error) {
+	if tx == nil {
+		return nil, fmt.Errorf("mysqlutils: UpdateReturning needs a transaction")
+	}
+	if clause, _, err := whereExpr(where); err != nil || clause == "" {
+		if err == nil {
+			err = ErrNoWhere
 		}
-		rowsValues = append(rowsValues, fmt.Sprintf("(%s)", strings.Join(rowValues, ", ")))
+		return nil, err
 	}
 
-	query += strings.Join(rowsValues, ", ")
+	keyColumns, err := primaryKeyColumns(ctx, tx, table)
+	if err != nil {
+		return nil, err
+	}
+	_, _, locked, err := selectRows(ctx, tx, table, keyColumns, where, []Option{ForUpdate()})
+	if err != nil {
+		return nil, err
+	}
+	if len(locked) == 0 {
+		return []map[string]interface{}{}, nil
+	}
+
+	keys := TupleIn{Columns: keyColumns, Values: make([][]interface{}, len(locked))}
+	for i, row := range locked {
+		values := make([]interface{}, len(keyColumns))
+		for j, col := range keyColumns {
+			values[j] = row[col]
+		}
+		keys.Values[i] = values
+	}
+
+	if _, _, err := update(ctx, tx, table, data, keys, false, newOptions(opts)); err != nil {
+		return nil, err
+	}
+	_, _, rows, err := selectRows(ctx, tx, table, columns, keys, opts)
+	return rows, err
+}
+
+// primaryKeyColumns returns the primary key columns of tableName in key
+// order. tableName may be qualified with a schema name.
+func primaryKeyColumns(ctx context.Context, db Querier, tableName string) ([]string, error) {
+	filter, args := tableFilter(tableName)
+	query := "SELECT COLUMN_NAME FROM information_schema.STATISTICS WHERE " + filter + " AND INDEX_NAME = 'PRIMARY' ORDER BY SEQ_IN_INDEX"
 
-	_, err := db.Exec(query, values...)
+	rows, err := queryContext(ctx, db, query, args...)
 	if err != nil {
-		return query, err
+		return nil, queryError("look up primary key", query, err)
 	}
+	defer rows.Close()
 
-	return query, nil
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, queryError("look up primary key", query, err)
+		}
+		columns = append(columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError("look up primary key", query, err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("mysqlutils: %s has no primary key", tableName)
+	}
+	return columns, nil
 }
 
-// Update updates multiple rows in a table based on the provided data and WHERE conditions.
-func Update(db *sql.DB, table string, data map[string]interface{}, where []map[string]interface{}) (string, error) {
+// buildUpdate renders the UPDATE statement and its arguments. Unless all is
+// set, it returns ErrNoWhere when where holds no conditions.
+func buildUpdate(table string, data map[string]interface{}, where interface{}, all bool) (string, []interface{}, error) {
+	if err := checkIdent(table); err != nil {
+		return "", nil, err
+	}
+
 	query := "UPDATE %s SET "
 
 	keys := []string{}
 	values := []interface{}{}
-	for key, value := range data {
-		keys = append(keys, fmt.Sprintf("%s = ?", key))
-		values = append(values, value)
+	// Sorted like the WHERE conditions, so the statement is stable.
+	for _, key := range sortedKeys(data) {
+		value := data[key]
+		if err := checkIdent(key); err != nil {
+			return "", nil, err
+		}
+		switch v := value.(type) {
+		case RawExpr:
+			if err := v.check(); err != nil {
+				return "", nil, err
+			}
+			keys = append(keys, fmt.Sprintf("%s = (%s)", quoteIdent(key), v.expr))
+			values = append(values, v.args...)
+		case increment:
+			keys = append(keys, fmt.Sprintf("%s = %s + ?", quoteIdent(key), quoteIdent(key)))
+			values = append(values, v.delta)
+		default:
+			keys = append(keys, fmt.Sprintf("%s = ?", quoteIdent(key)))
+			values = append(values, bindValue(value))
+		}
 	}
-	query = fmt.Sprintf(query+strings.Join(keys, ", "), table)
+	query = fmt.Sprintf(query, quoteIdent(table)) + strings.Join(keys, ", ")
 
-	whereConditions := []string{}
-	for _, condition := range where {
-		for key, value := range condition {
-			whereConditions = append(whereConditions, fmt.Sprintf("%s = ?", key))
-			values = append(values, value)
-		}
+	whereConditions, whereValues, err := buildWhere(where)
+	if err != nil {
+		return query, nil, err
+	}
+	if whereConditions == "" && !all {
+		return query, nil, ErrNoWhere
+	}
+	query += whereConditions
+	values = append(values, whereValues...)
+
+	return query, values, nil
+}
+
+// BatchUpdate updates many rows, each with its own values, identified by
+// keyColumn. Every map in rows must hold keyColumn; its other entries are the
+// columns to set for that row, and rows may set different columns. Rows are
+// sent in chunks of up to DefaultBatchSize, fewer when needed to stay within
+// MySQL's limit of 65,535 placeholders, as UPDATE ... SET col = CASE
+// keyColumn WHEN ... END statements, inside a single transaction unless db is
+// already one. It returns the total number of rows changed.
+func BatchUpdate(db Querier, table, keyColumn string, rows []map[string]interface{}) (int64, error) {
+	return BatchUpdateContext(context.Background(), db, table, keyColumn, rows)
+}
+
+// BatchUpdateContext is like BatchUpdate but runs the statements with the given context.
+func BatchUpdateContext(ctx context.Context, db Querier, table, keyColumn string, rows []map[string]interface{}) (total int64, err error) {
+	defer func(start time.Time) { observe(OpUpdate, start, total, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
 	}
-	query += " WHERE " + strings.Join(whereConditions, " AND ")
 
-	stmt, err := db.Prepare(query)
+	err = inTx(ctx, db, func(q Querier) error {
+		for start, end := 0, 0; start < len(rows); start = end {
+			end = batchUpdateEnd(rows, start)
+			query, args, err := buildBatchUpdate(table, keyColumn, rows[start:end])
+			if err != nil {
+				return err
+			}
+			op := fmt.Sprintf("batch update at row %d", start)
+			result, err := execContext(ctx, q, query, args...)
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return queryError(op, query, err)
+			}
+			total += affected
+		}
+		return nil
+	})
 	if err != nil {
-		return query, err
+		return 0, err
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec(values...)
-	return query, err
+	return total, nil
 }
 
-func Delete(db *sql.DB, table string, conditions map[string]interface{}) (string, bool, error) {
-	var query strings.Builder
-	var args []interface{}
+// batchUpdateEnd returns the end of the BatchUpdate chunk starting at
+// rows[start]: at most DefaultBatchSize rows whose placeholders, a key and a
+// value for each column set plus the key in the IN list, fit within
+// maxPlaceholders. A chunk always holds at least one row.
+func batchUpdateEnd(rows []map[string]interface{}, start int) int {
+	end, placeholders := start, 0
+	for end < len(rows) && end-start < DefaultBatchSize {
+		n := 2*len(rows[end]) - 1
+		if end > start && placeholders+n > maxPlaceholders {
+			break
+		}
+		placeholders += n
+		end++
+	}
+	return end
+}
 
-	query.WriteString("DELETE FROM " + table)
+// buildBatchUpdate renders one BatchUpdate statement for rows.
+func buildBatchUpdate(table, keyColumn string, rows []map[string]interface{}) (string, []interface{}, error) {
+	if err := checkIdent(table, keyColumn); err != nil {
+		return "", nil, err
+	}
 
-	if len(conditions) > 0 {
-		query.WriteString(" WHERE ")
+	seen := map[string]bool{}
+	columns := []string{}
+	keys := make([]interface{}, len(rows))
+	for i, row := range rows {
+		key, ok := row[keyColumn]
+		if !ok {
+			return "", nil, fmt.Errorf("mysqlutils: batch update row %d has no %s", i, keyColumn)
+		}
+		keys[i] = bindValue(key)
+		for col := range row {
+			if col != keyColumn && !seen[col] {
+				seen[col] = true
+				columns = append(columns, col)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return "", nil, fmt.Errorf("mysqlutils: batch update of %s has no columns to set", table)
+	}
+	sort.Strings(columns)
+	if err := checkIdent(columns...); err != nil {
+		return "", nil, err
+	}
 
-		// Build the conditions and collect the arguments
-		i := 0
-		for field, value := range conditions {
-			if i > 0 {
-				query.WriteString(" AND ")
+	quotedKey := quoteIdent(keyColumn)
+	var args []interface{}
+	assignments := make([]string, len(columns))
+	for i, col := range columns {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s = CASE %s", quoteIdent(col), quotedKey)
+		for j, row := range rows {
+			if value, ok := row[col]; ok {
+				b.WriteString(" WHEN ? THEN ?")
+				args = append(args, keys[j], bindValue(value))
 			}
-			query.WriteString(field + " = ?")
-			args = append(args, value)
-			i++
 		}
+		fmt.Fprintf(&b, " ELSE %s END", quoteIdent(col))
+		assignments[i] = b.String()
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s IN (%s)", quoteIdent(table), strings.Join(assignments, ", "), quotedKey, placeholders)
+	return query, append(args, keys...), nil
+}
+
+// Delete deletes the rows matching conditions and reports whether any row was removed.
+// conditions accepts any of the forms described on Cond.
+func Delete(db Querier, table string, conditions interface{}, opts ...Option) (string, bool, error) {
+	return DeleteContext(context.Background(), db, table, conditions, opts...)
+}
+
+// DeleteContext is like Delete but runs the statement with the given context.
+func DeleteContext(ctx context.Context, db Querier, table string, conditions interface{}, opts ...Option) (string, bool, error) {
+	query, rowsAffected, err := DeleteNContext(ctx, db, table, conditions, opts...)
+	return query, rowsAffected > 0, err
+}
+
+// DeleteN is like Delete but returns the number of rows deleted.
+func DeleteN(db Querier, table string, conditions interface{}, opts ...Option) (string, int64, error) {
+	return DeleteNContext(context.Background(), db, table, conditions, opts...)
+}
+
+// DeleteNContext is like DeleteN but runs the statement with the given context.
+func DeleteNContext(ctx context.Context, db Querier, table string, conditions interface{}, opts ...Option) (query string, rowsAffected int64, err error) {
+	o := newOptions(opts)
+	defer func(start time.Time) { o.observe(OpDelete, start, rowsAffected, err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return "", 0, err
+	}
+	query, args, err := buildDelete(table, conditions)
+	if err != nil {
+		return query, 0, err
 	}
 
 	// Execute the delete query
-	result, err := db.Exec(query.String(), args...)
+	result, err := o.exec(ctx, db, query, args...)
+	if err != nil {
+		return query, 0, queryError("delete", query, err)
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return query, 0, queryError("delete", query, err)
+	}
+	return query, rowsAffected, nil
+}
+
+// DeleteByIDs deletes the rows of table whose idColumn is one of ids, using
+// DELETE ... WHERE idColumn IN (...) statements, and returns the number of
+// rows deleted. ids are split across statements as needed to stay within
+// MySQL's limit of 65,535 placeholders, run in a single transaction unless db
+// is already one. It runs nothing when ids is empty.
+func DeleteByIDs(db Querier, table, idColumn string, ids []interface{}, opts ...Option) (int64, error) {
+	return DeleteByIDsContext(context.Background(), db, table, idColumn, ids, opts...)
+}
+
+// DeleteByIDsContext is like DeleteByIDs but runs the statements with the
+// given context.
+func DeleteByIDsContext(ctx context.Context, db Querier, table, idColumn string, ids []interface{}, opts ...Option) (total int64, err error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	o := newOptions(opts)
+	defer func(start time.Time) { o.observe(OpDelete, start, total, err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return 0, err
+	}
+
+	err = o.inTx(ctx, db, func(q Querier) error {
+		for start := 0; start < len(ids); start += maxPlaceholders {
+			end := start + maxPlaceholders
+			if end > len(ids) {
+				end = len(ids)
+			}
+
+			query, args, err := buildDelete(table, Cond{Column: idColumn, Op: "IN", Value: ids[start:end]})
+			if err != nil {
+				return err
+			}
+			result, err := o.exec(ctx, q, query, args...)
+			if err != nil {
+				return queryError("delete", query, err)
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return queryError("delete", query, err)
+			}
+			total += affected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// SoftDelete marks the rows of table matching conditions as deleted by setting
+// column, typically deleted_at, to NOW() instead of removing them. Rows that
+// are already marked keep their original timestamp. Like Update it returns
+// ErrNoWhere when conditions is empty. It returns the number of rows marked;
+// use the ExcludeDeleted option to leave them out of Select.
+func SoftDelete(db Querier, table string, conditions interface{}, column string) (string, int64, error) {
+	return SoftDeleteContext(context.Background(), db, table, conditions, column)
+}
+
+// SoftDeleteContext is like SoftDelete but runs the statement with the given context.
+func SoftDeleteContext(ctx context.Context, db Querier, table string, conditions interface{}, column string) (query string, affected int64, err error) {
+	defer func(start time.Time) { observe(OpUpdate, start, affected, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := checkIdent(table, column); err != nil {
+		return "", 0, err
+	}
+
+	where, args, err := buildWhere(conditions)
+	if err != nil {
+		return "", 0, err
+	}
+	if where == "" {
+		return "", 0, ErrNoWhere
+	}
+
+	query = fmt.Sprintf("UPDATE %s SET %s = NOW()%s AND %s IS NULL", quoteIdent(table), quoteIdent(column), where, quoteIdent(column))
+	result, err := execContext(ctx, db, query, args...)
+	if err != nil {
+		return query, 0, queryError("soft delete", query, err)
+	}
+
+	affected, err = result.RowsAffected()
+	if err != nil {
+		return query, 0, queryError("soft delete", query, err)
+	}
+	return query, affected, nil
+}
+
+// buildDelete renders the DELETE statement and its arguments.
+func buildDelete(table string, conditions interface{}) (string, []interface{}, error) {
+	if err := checkIdent(table); err != nil {
+		return "", nil, err
+	}
+
+	query := "DELETE FROM " + quoteIdent(table)
+	where, args, err := buildWhere(conditions)
+	if err != nil {
+		return query, nil, err
+	}
+	return query + where, args, nil
+}
+
+// DeleteJoin deletes rows of target that match conditions across tableName
+// and the tables joined into it with the InnerJoin and LeftJoin options, as
+// in
+//
+//	DeleteJoin(db, "orders", "orders", Cond{"users.banned", "=", 1},
+//		InnerJoin("users", "orders.user_id", "users.id"))
+//
+// which renders DELETE orders FROM orders INNER JOIN users ON ... WHERE
+// users.banned = ?. target must be tableName or one of the joined tables;
+// rows of the other tables are left alone. It returns the number of rows
+// deleted. DryRun and WithTimeout apply as for Delete.
+func DeleteJoin(db Querier, target, tableName string, conditions interface{}, opts ...Option) (string, int64, error) {
+	return DeleteJoinContext(context.Background(), db, target, tableName, conditions, opts...)
+}
+
+// DeleteJoinContext is like DeleteJoin but runs the statement with the given
+// context.
+func DeleteJoinContext(ctx context.Context, db Querier, target, tableName string, conditions interface{}, opts ...Option) (query string, rowsAffected int64, err error) {
+	o := newOptions(opts)
+	defer func(start time.Time) { o.observe(OpDelete, start, rowsAffected, err) }(time.Now())
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	db, err = o.resolveDB(db)
+	if err != nil {
+		return "", 0, err
+	}
+	query, args, err := buildDeleteJoin(target, tableName, conditions, o)
+	if err != nil {
+		return query, 0, err
+	}
+
+	result, err := o.exec(ctx, db, query, args...)
+	if err != nil {
+		return query, 0, queryError("delete", query, err)
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return query, 0, queryError("delete", query, err)
+	}
+	return query, rowsAffected, nil
+}
+
+// buildDeleteJoin renders the multi-table DELETE statement for DeleteJoin.
+func buildDeleteJoin(target, tableName string, conditions interface{}, o *options) (string, []interface{}, error) {
+	if err := checkIdent(target, tableName); err != nil {
+		return "", nil, err
+	}
+	if len(o.joins) == 0 {
+		return "", nil, fmt.Errorf("mysqlutils: DeleteJoin needs at least one join; use Delete instead")
+	}
+	known := target == tableName
+	for _, j := range o.joins {
+		known = known || target == j.table
+	}
+	if !known {
+		return "", nil, fmt.Errorf("mysqlutils: DeleteJoin target %s is not one of the joined tables", target)
+	}
+
+	query := "DELETE " + quoteIdent(target) + " FROM " + quoteIdent(tableName)
+	joins, err := o.joinClause()
+	if err != nil {
+		return query, nil, err
+	}
+	query += joins
+
+	where, args, err := buildWhere(conditions)
+	if err != nil {
+		return query, nil, err
+	}
+	return query + where, args, nil
+}
+
+// Truncate empties tableName with TRUNCATE TABLE, which also resets its
+// AUTO_INCREMENT counter. MySQL commits TRUNCATE implicitly, so it cannot be
+// rolled back even inside a transaction; use DeleteAll when that matters.
+func Truncate(db Querier, tableName string) error {
+	return TruncateContext(context.Background(), db, tableName)
+}
+
+// TruncateContext is like Truncate but runs the statement with the given context.
+func TruncateContext(ctx context.Context, db Querier, tableName string) (err error) {
+	defer func(start time.Time) { observe(OpDelete, start, 0, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return err
+	}
+	if err := checkIdent(tableName); err != nil {
+		return err
+	}
+
+	query := "TRUNCATE TABLE " + quoteIdent(tableName)
+	if _, err := execContext(ctx, db, query); err != nil {
+		return queryError("truncate", query, err)
+	}
+	return nil
+}
+
+// DeleteAll removes every row of tableName with DELETE FROM. It is slower
+// than Truncate but transactional, and it returns the number of rows deleted.
+func DeleteAll(db Querier, tableName string) (int64, error) {
+	return DeleteAllContext(context.Background(), db, tableName)
+}
+
+// DeleteAllContext is like DeleteAll but runs the statement with the given context.
+func DeleteAllContext(ctx context.Context, db Querier, tableName string) (affected int64, err error) {
+	defer func(start time.Time) { observe(OpDelete, start, affected, err) }(time.Now())
+	db, err = resolveDB(db)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkIdent(tableName); err != nil {
+		return 0, err
+	}
+
+	query := "DELETE FROM " + quoteIdent(tableName)
+	result, err := execContext(ctx, db, query)
 	if err != nil {
-		return query.String(), false, err
+		return 0, queryError("delete", query, err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	affected, err = result.RowsAffected()
 	if err != nil {
-		return query.String(), false, err
+		return 0, queryError("delete", query, err)
 	}
-	return query.String(), rowsAffected > 0, nil
+	return affected, nil
 }
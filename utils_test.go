@@ -0,0 +1,178 @@
+package mysqlutils
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestInsertBindsNilsAsNull(t *testing.T) {
+	var (
+		query string
+		args  []interface{}
+	)
+	record := DryRun(func(q string, a []interface{}) { query, args = q, a })
+
+	name := "ann"
+	row := map[string]interface{}{
+		"a_nil":         nil,
+		"b_nil_string":  (*string)(nil),
+		"c_nil_int":     (*int)(nil),
+		"d_null_string": sql.NullString{},
+		"e_string":      &name,
+		"f_valid":       sql.NullString{String: "x", Valid: true},
+	}
+	if _, _, _, err := Insert(nil, "users", []map[string]interface{}{row}, record); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "INSERT INTO `users` (`a_nil`, `b_nil_string`, `c_nil_int`, `d_null_string`, `e_string`, `f_valid`) VALUES(?, ?, ?, ?, ?, ?)"
+	if query != want {
+		t.Fatalf("query = %q, want %q", query, want)
+	}
+	if len(args) != 6 {
+		t.Fatalf("got %d args, want 6", len(args))
+	}
+	for i := 0; i < 4; i++ {
+		if args[i] != nil {
+			t.Errorf("arg %d = %#v, want nil", i, args[i])
+		}
+	}
+	if args[4] != &name {
+		t.Errorf("arg 4 = %#v, want the non-nil pointer", args[4])
+	}
+	if args[5] != row["f_valid"] {
+		t.Errorf("arg 5 = %#v, want the valid sql.NullString", args[5])
+	}
+}
+
+func TestInsertReturningIDsDryRun(t *testing.T) {
+	var queries []string
+	dry := DryRun(func(q string, _ []interface{}) { queries = append(queries, q) })
+
+	data := []map[string]interface{}{{"name": "a"}, {"name": "b"}, {"name": "c"}}
+	ids, err := InsertReturningIDs(nil, "users", data, 2, dry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(data) {
+		t.Errorf("got %d IDs, want %d", len(ids), len(data))
+	}
+	if len(queries) != 2 {
+		t.Errorf("got %d statements, want 2 batches: %q", len(queries), queries)
+	}
+}
+
+func TestInsertBatchWideRows(t *testing.T) {
+	var counts []int
+	dry := DryRun(func(_ string, a []interface{}) { counts = append(counts, len(a)) })
+
+	row := make(map[string]interface{}, 70)
+	for i := 0; i < 70; i++ {
+		row[fmt.Sprintf("c%d", i)] = i
+	}
+	data := make([]map[string]interface{}, DefaultBatchSize)
+	for i := range data {
+		data[i] = row
+	}
+	if _, err := InsertBatch(nil, "wide", data, 0, dry); err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 {
+		t.Fatalf("got %d statements, want 2: %v", len(counts), counts)
+	}
+	for _, n := range counts {
+		if n > maxPlaceholders {
+			t.Errorf("statement has %d placeholders, want at most %d", n, maxPlaceholders)
+		}
+	}
+}
+
+func TestBatchUpdateEnd(t *testing.T) {
+	narrow := []map[string]interface{}{{"id": 1, "a": 1}}
+	rows := make([]map[string]interface{}, 2*DefaultBatchSize)
+	for i := range rows {
+		rows[i] = narrow[0]
+	}
+	if end := batchUpdateEnd(rows, 0); end != DefaultBatchSize {
+		t.Errorf("narrow rows: end = %d, want %d", end, DefaultBatchSize)
+	}
+
+	wide := make(map[string]interface{}, 101)
+	for i := 0; i <= 100; i++ {
+		wide[fmt.Sprintf("c%d", i)] = i
+	}
+	for i := range rows {
+		rows[i] = wide
+	}
+	// 101 columns need 201 placeholders a row.
+	if end, want := batchUpdateEnd(rows, 0), maxPlaceholders/201; end != want {
+		t.Errorf("wide rows: end = %d, want %d", end, want)
+	}
+}
+
+func TestUpsertDryRun(t *testing.T) {
+	var queries []string
+	dry := DryRun(func(q string, _ []interface{}) { queries = append(queries, q) })
+
+	data := []map[string]interface{}{{"id": 1, "name": "a"}, {"id": 2, "name": "b"}}
+	if _, _, err := Upsert(nil, "users", data, []string{"name"}, dry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpsertBatch(nil, "users", data, []string{"name"}, 1, dry); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 3 {
+		t.Fatalf("got %d statements, want 3: %q", len(queries), queries)
+	}
+	for _, q := range queries {
+		if !strings.Contains(q, " ON DUPLICATE KEY UPDATE ") {
+			t.Errorf("query %q has no ON DUPLICATE KEY UPDATE clause", q)
+		}
+	}
+
+	if _, _, err := Upsert(nil, "users", data, nil, dry); err == nil {
+		t.Error("Upsert with no updateColumns and no connection: want an error")
+	}
+}
+
+func TestBuildBatchUpdateBindsNilsAsNull(t *testing.T) {
+	var note *string
+	rows := []map[string]interface{}{
+		{"id": 1, "note": note},
+		{"id": 2, "note": sql.NullString{}},
+	}
+	query, args, err := buildBatchUpdate("users", "id", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "UPDATE `users` SET `note` = CASE `id` WHEN ? THEN ? WHEN ? THEN ? ELSE `note` END WHERE `id` IN (?, ?)"; query != want {
+		t.Errorf("query = %q, want %q", query, want)
+	}
+	want := []interface{}{1, nil, 2, nil, 1, 2}
+	if len(args) != len(want) {
+		t.Fatalf("got %d args, want %d", len(args), len(want))
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("arg %d = %#v, want %#v", i, args[i], want[i])
+		}
+	}
+}
+
+func TestDeleteByIDsSplitsLargeLists(t *testing.T) {
+	var counts []int
+	dry := DryRun(func(_ string, a []interface{}) { counts = append(counts, len(a)) })
+
+	ids := make([]interface{}, maxPlaceholders+1)
+	for i := range ids {
+		ids[i] = i
+	}
+	if _, err := DeleteByIDs(nil, "users", "id", ids, dry); err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[0] != maxPlaceholders || counts[1] != 1 {
+		t.Errorf("got statements with %v placeholders, want [%d 1]", counts, maxPlaceholders)
+	}
+}
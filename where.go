@@ -0,0 +1,571 @@
+package mysqlutils
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Cond is a single WHERE condition comparing Column to Value with Op, for
+// example Cond{"age", ">", 18}. Column may also be an aggregate call such as
+// COUNT(*), for use with Having. The IN and NOT IN operators take a slice
+// Value and expand to one placeholder per element. BETWEEN and NOT BETWEEN
+// take a two-element slice holding the low and high bounds; see Between.
+//
+// Functions that take a WHERE argument accept a map[string]interface{}, whose
+// entries are matched for equality, a []map[string]interface{}, a Cond or a
+// []Cond, a TupleIn, a Group built with Or or And, a fragment from RawCond,
+// or a *WhereBuilder. All conditions are joined with AND. A nil value,
+// including a nil pointer or an invalid sql.Null* value, matches NULL with IS
+// NULL, since = NULL never matches, and the NotNull value matches any
+// non-NULL value with IS NOT NULL. A slice value in a map matches any of its
+// elements, as with IN. An empty IN list matches no rows. Map entries render
+// sorted by column name, so a query is the same on every run.
+type Cond struct {
+	Column string
+	Op     string
+	Value  interface{}
+}
+
+// condition is implemented by the WHERE forms that render as a single term.
+type condition interface {
+	sql() (string, []interface{}, error)
+}
+
+// whereOps lists the operators a Cond may use. Anything else is rejected
+// because the operator is interpolated into the query.
+var whereOps = map[string]bool{
+	"=":        true,
+	"!=":       true,
+	"<>":       true,
+	"<":        true,
+	"<=":       true,
+	">":        true,
+	">=":       true,
+	"LIKE":     true,
+	"NOT LIKE": true,
+	"IN":       true,
+	"NOT IN":   true,
+
+	"BETWEEN":     true,
+	"NOT BETWEEN": true,
+
+	"IS NULL":     true,
+	"IS NOT NULL": true,
+}
+
+// notNull is the type of NotNull.
+type notNull struct{}
+
+// NotNull is a WHERE value matching rows where the column is not NULL, as in
+// map[string]interface{}{"email": NotNull}.
+var NotNull = notNull{}
+
+// null is the type of Null.
+type null struct{}
+
+// Null is a value that always stands for SQL NULL, whatever the column's
+// type. In Insert and Update data it sets the column to NULL, as in
+// map[string]interface{}{"deleted_at": Null}; in a WHERE map it matches NULL
+// like nil does. Writing Null states the intent explicitly, where a nil value
+// is easily produced by accident. Note the difference from leaving the key
+// out: Update then leaves the column unchanged and Insert gives it its
+// default, while UpdatedAt and CreatedAt fill in only missing keys, so a
+// Null timestamp column stays NULL.
+var Null = null{}
+
+// Value implements driver.Valuer, so Null binds as NULL even when passed to
+// the driver directly, as with Exec.
+func (null) Value() (driver.Value, error) {
+	return nil, nil
+}
+
+func (c Cond) sql() (string, []interface{}, error) {
+	op := strings.ToUpper(strings.TrimSpace(c.Op))
+	if !whereOps[op] {
+		return "", nil, fmt.Errorf("mysqlutils: unsupported WHERE operator %q", c.Op)
+	}
+	column, err := columnExpr(c.Column)
+	if err != nil {
+		return "", nil, err
+	}
+	if op == "IN" || op == "NOT IN" {
+		return c.inSQL(column, op)
+	}
+	if op == "BETWEEN" || op == "NOT BETWEEN" {
+		values, ok := listValues(c.Value)
+		if !ok || len(values) != 2 {
+			return "", nil, fmt.Errorf("mysqlutils: %s on %s needs a low and high value, got %v", op, c.Column, c.Value)
+		}
+		return fmt.Sprintf("%s %s ? AND ?", column, op), values, nil
+	}
+	if op, ok, err := nullOp(op, c.Value); ok || err != nil {
+		if err != nil {
+			return "", nil, fmt.Errorf("mysqlutils: condition on %s: %w", c.Column, err)
+		}
+		return column + " " + op, nil, nil
+	}
+	return fmt.Sprintf("%s %s ?", column, op), []interface{}{c.Value}, nil
+}
+
+// Between matches rows where column lies between low and high, inclusive,
+// rendering as column BETWEEN ? AND ?.
+func Between(column string, low, high interface{}) Cond {
+	return Cond{Column: column, Op: "BETWEEN", Value: []interface{}{low, high}}
+}
+
+// likeEscaper escapes the characters LIKE treats specially.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes the LIKE wildcards % and _, and the backslash escape
+// character itself, so s matches only itself in a LIKE pattern. Add your own
+// wildcards around the result, as in Cond{"name", "LIKE", EscapeLike(q) + "%"}.
+// It relies on backslash being the escape character, which is not the case
+// when the NO_BACKSLASH_ESCAPES SQL mode is enabled.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Contains matches rows where column contains s, with any wildcards in s
+// escaped.
+func Contains(column, s string) Cond {
+	return Cond{Column: column, Op: "LIKE", Value: "%" + EscapeLike(s) + "%"}
+}
+
+// HasPrefix matches rows where column starts with s, with any wildcards in s
+// escaped.
+func HasPrefix(column, s string) Cond {
+	return Cond{Column: column, Op: "LIKE", Value: EscapeLike(s) + "%"}
+}
+
+// HasSuffix matches rows where column ends with s, with any wildcards in s
+// escaped.
+func HasSuffix(column, s string) Cond {
+	return Cond{Column: column, Op: "LIKE", Value: "%" + EscapeLike(s)}
+}
+
+// isNull reports whether v stands for SQL NULL: nil, a nil pointer, or a
+// driver.Valuer such as Null or an invalid sql.NullString whose value is nil.
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return true
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		return err == nil && value == nil
+	}
+	return false
+}
+
+// bindValue returns nil for any value isNull treats as NULL, and v otherwise,
+// so NULLs are bound the same way whatever form they take.
+func bindValue(v interface{}) interface{} {
+	if isNull(v) {
+		return nil
+	}
+	return v
+}
+
+// nullOp maps a comparison against nil or NotNull to IS NULL or IS NOT NULL.
+// ok is false when the condition does not involve NULL.
+func nullOp(op string, value interface{}) (string, bool, error) {
+	switch {
+	case op == "IS NULL" || op == "IS NOT NULL":
+		return op, true, nil
+	case isNull(value):
+		switch op {
+		case "=":
+			return "IS NULL", true, nil
+		case "!=", "<>":
+			return "IS NOT NULL", true, nil
+		}
+		return "", false, fmt.Errorf("NULL cannot be compared with %s", op)
+	case value == NotNull:
+		if op == "=" {
+			return "IS NOT NULL", true, nil
+		}
+		return "", false, fmt.Errorf("NotNull cannot be compared with %s", op)
+	}
+	return "", false, nil
+}
+
+// inSQL renders an IN or NOT IN condition with one placeholder per element of
+// the slice value. Empty lists become a constant condition, since MySQL
+// rejects IN ().
+func (c Cond) inSQL(column, op string) (string, []interface{}, error) {
+	values, ok := listValues(c.Value)
+	if !ok {
+		return "", nil, fmt.Errorf("mysqlutils: %s on %s needs a slice value, got %T", op, c.Column, c.Value)
+	}
+	if len(values) == 0 {
+		if op == "IN" {
+			return "1 = 0", nil, nil
+		}
+		return "1 = 1", nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	return fmt.Sprintf("%s %s (%s)", column, op, placeholders), values, nil
+}
+
+// listValues returns the elements of v if it is a slice or array. Byte
+// slices and arrays, including named ones such as json.RawMessage, net.IP or
+// a [16]byte UUID, and any driver.Valuer are treated as a single value rather
+// than a list.
+func listValues(v interface{}) ([]interface{}, bool) {
+	if _, ok := v.(driver.Valuer); ok {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	if rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, true
+}
+
+// buildWhere renders the WHERE clause for where, including the leading
+// keyword. It returns an empty clause when there are no conditions.
+func buildWhere(where interface{}) (string, []interface{}, error) {
+	clause, args, err := whereExpr(where)
+	if err != nil || clause == "" {
+		return "", nil, err
+	}
+	return " WHERE " + clause, args, nil
+}
+
+// whereExpr renders the conditions in where joined with AND, without the
+// WHERE keyword.
+func whereExpr(where interface{}) (string, []interface{}, error) {
+	terms, args, err := whereTerms(where)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.Join(terms, " AND "), args, nil
+}
+
+// whereTerms renders where as a list of self-contained terms that the caller
+// joins with AND.
+func whereTerms(where interface{}) ([]string, []interface{}, error) {
+	var conds []Cond
+	switch w := where.(type) {
+	case nil:
+	case map[string]interface{}:
+		conds = mapConds(w)
+	case []map[string]interface{}:
+		for _, m := range w {
+			conds = append(conds, mapConds(m)...)
+		}
+	case []Cond:
+		conds = w
+	case *WhereBuilder:
+		// At the top level the builder's terms need no parentheses.
+		var terms []string
+		var args []interface{}
+		for _, c := range w.list() {
+			cterms, cargs, err := whereTerms(c)
+			if err != nil {
+				return nil, nil, err
+			}
+			terms = append(terms, cterms...)
+			args = append(args, cargs...)
+		}
+		return terms, args, nil
+	case condition:
+		term, args, err := w.sql()
+		if err != nil || term == "" {
+			return nil, nil, err
+		}
+		return []string{term}, args, nil
+	default:
+		return nil, nil, fmt.Errorf("mysqlutils: unsupported WHERE type %T", where)
+	}
+
+	terms := make([]string, 0, len(conds))
+	var args []interface{}
+	for _, c := range conds {
+		term, termArgs, err := c.sql()
+		if err != nil {
+			return nil, nil, err
+		}
+		terms = append(terms, term)
+		args = append(args, termArgs...)
+	}
+	return terms, args, nil
+}
+
+// mapConds turns each entry of m into an equality condition, or an IN
+// condition for slice values. The conditions are sorted by column so the
+// same map always renders the same query.
+func mapConds(m map[string]interface{}) []Cond {
+	conds := make([]Cond, 0, len(m))
+	for _, key := range sortedKeys(m) {
+		value := m[key]
+		op := "="
+		if _, ok := listValues(value); ok {
+			op = "IN"
+		}
+		conds = append(conds, Cond{Column: key, Op: op, Value: value})
+	}
+	return conds
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Group combines WHERE conditions with OR or AND. Build one with Or or And.
+type Group struct {
+	op    string
+	conds []interface{}
+}
+
+// Or matches rows satisfying any of conds. Each element may be any WHERE
+// form; the entries of a map inside Or are still ANDed together, so
+// Or(map[string]interface{}{"a": 1, "b": 2}, Cond{"c", ">", 3}) renders as
+// ((a = ? AND b = ?) OR c > ?).
+func Or(conds ...interface{}) Group {
+	return Group{op: "OR", conds: conds}
+}
+
+// And matches rows satisfying all of conds. It is mainly useful for nesting
+// inside Or.
+func And(conds ...interface{}) Group {
+	return Group{op: "AND", conds: conds}
+}
+
+// sql renders the group as a single parenthesized term, or an empty string if
+// it holds no conditions.
+func (g Group) sql() (string, []interface{}, error) {
+	parts := make([]string, 0, len(g.conds))
+	var args []interface{}
+	for _, c := range g.conds {
+		terms, termArgs, err := whereTerms(c)
+		if err != nil {
+			return "", nil, err
+		}
+		switch len(terms) {
+		case 0:
+			continue
+		case 1:
+			parts = append(parts, terms[0])
+		default:
+			parts = append(parts, "("+strings.Join(terms, " AND ")+")")
+		}
+		args = append(args, termArgs...)
+	}
+
+	switch len(parts) {
+	case 0:
+		return "", nil, nil
+	case 1:
+		return parts[0], args, nil
+	}
+	return "(" + strings.Join(parts, " "+g.op+" ") + ")", args, nil
+}
+
+// TupleIn matches rows whose Columns, taken together, equal one of the
+// tuples in Values, rendering as (a, b) IN ((?, ?), (?, ?)). Each tuple must
+// hold one value per column, in the same order. Empty Values match no rows.
+type TupleIn struct {
+	Columns []string
+	Values  [][]interface{}
+}
+
+func (t TupleIn) sql() (string, []interface{}, error) {
+	if len(t.Columns) == 0 {
+		return "", nil, fmt.Errorf("mysqlutils: TupleIn needs at least one column")
+	}
+	if err := checkColumnRef(t.Columns...); err != nil {
+		return "", nil, err
+	}
+	if len(t.Values) == 0 {
+		return "1 = 0", nil, nil
+	}
+
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(t.Columns)), ", ") + ")"
+	var args []interface{}
+	for i, values := range t.Values {
+		if len(values) != len(t.Columns) {
+			return "", nil, fmt.Errorf("mysqlutils: TupleIn tuple %d has %d values for %d columns", i, len(values), len(t.Columns))
+		}
+		args = append(args, values...)
+	}
+
+	tuples := strings.TrimSuffix(strings.Repeat(tuple+", ", len(t.Values)), ", ")
+	return fmt.Sprintf("(%s) IN (%s)", strings.Join(quoteIdents(t.Columns), ", "), tuples), args, nil
+}
+
+// rawCond is the type of the conditions returned by RawCond.
+type rawCond struct {
+	expr string
+	args []interface{}
+}
+
+// RawCond returns a WHERE condition written into the query as is, with args
+// bound to the ? placeholders in expr, for conditions the other forms cannot
+// express, as in RawCond("DATE(created_at) = CURDATE()") or
+// RawCond("JSON_CONTAINS(tags, ?)", `"go"`). It is joined to the other
+// conditions with AND and parenthesized, so an OR inside it stays grouped.
+//
+// expr is not checked or escaped in any way: the caller is responsible for
+// its safety, and must never build it from untrusted input. Pass such input
+// only through args.
+func RawCond(expr string, args ...interface{}) interface{} {
+	return rawCond{expr: expr, args: args}
+}
+
+func (r rawCond) sql() (string, []interface{}, error) {
+	if strings.TrimSpace(r.expr) == "" {
+		return "", nil, fmt.Errorf("mysqlutils: empty raw condition")
+	}
+	if n := countPlaceholders(r.expr); n != len(r.args) {
+		return "", nil, fmt.Errorf("mysqlutils: raw condition %q has %d placeholders for %d args", r.expr, n, len(r.args))
+	}
+	return "(" + r.expr + ")", r.args, nil
+}
+
+// countPlaceholders counts the ? placeholders in expr, leaving out any inside
+// quoted text or comments.
+func countPlaceholders(expr string) int {
+	n := 0
+	for i := 0; i < len(expr); {
+		if end := skipLiteral(expr, i); end > i {
+			i = end
+			continue
+		}
+		if expr[i] == '?' {
+			n++
+		}
+		i++
+	}
+	return n
+}
+
+// WhereBuilder assembles WHERE conditions fluently, as in
+//
+//	NewWhere().Eq("status", "active").Gt("age", 18).Or(Cond{"vip", "=", true}, Cond{"score", ">", 90})
+//
+// Conditions are joined with AND. A *WhereBuilder is accepted wherever a
+// WHERE argument is, and renders exactly like the equivalent Cond values.
+type WhereBuilder struct {
+	conds []interface{}
+}
+
+// NewWhere returns an empty WhereBuilder, which matches every row.
+func NewWhere() *WhereBuilder {
+	return &WhereBuilder{}
+}
+
+// Where adds cond, which may be any of the WHERE forms described on Cond.
+func (w *WhereBuilder) Where(cond interface{}) *WhereBuilder {
+	w.conds = append(w.conds, cond)
+	return w
+}
+
+func (w *WhereBuilder) add(column, op string, value interface{}) *WhereBuilder {
+	return w.Where(Cond{Column: column, Op: op, Value: value})
+}
+
+// Eq adds column = value, or column IS NULL when value is nil.
+func (w *WhereBuilder) Eq(column string, value interface{}) *WhereBuilder {
+	return w.add(column, "=", value)
+}
+
+// Ne adds column != value, or column IS NOT NULL when value is nil.
+func (w *WhereBuilder) Ne(column string, value interface{}) *WhereBuilder {
+	return w.add(column, "!=", value)
+}
+
+// Gt adds column > value.
+func (w *WhereBuilder) Gt(column string, value interface{}) *WhereBuilder {
+	return w.add(column, ">", value)
+}
+
+// Gte adds column >= value.
+func (w *WhereBuilder) Gte(column string, value interface{}) *WhereBuilder {
+	return w.add(column, ">=", value)
+}
+
+// Lt adds column < value.
+func (w *WhereBuilder) Lt(column string, value interface{}) *WhereBuilder {
+	return w.add(column, "<", value)
+}
+
+// Lte adds column <= value.
+func (w *WhereBuilder) Lte(column string, value interface{}) *WhereBuilder {
+	return w.add(column, "<=", value)
+}
+
+// In adds column IN (...) for the elements of values, which must be a slice.
+func (w *WhereBuilder) In(column string, values interface{}) *WhereBuilder {
+	return w.add(column, "IN", values)
+}
+
+// NotIn adds column NOT IN (...) for the elements of values, which must be a
+// slice.
+func (w *WhereBuilder) NotIn(column string, values interface{}) *WhereBuilder {
+	return w.add(column, "NOT IN", values)
+}
+
+// Like adds column LIKE pattern.
+func (w *WhereBuilder) Like(column, pattern string) *WhereBuilder {
+	return w.add(column, "LIKE", pattern)
+}
+
+// Between adds column BETWEEN low AND high.
+func (w *WhereBuilder) Between(column string, low, high interface{}) *WhereBuilder {
+	return w.Where(Between(column, low, high))
+}
+
+// IsNull adds column IS NULL.
+func (w *WhereBuilder) IsNull(column string) *WhereBuilder {
+	return w.add(column, "IS NULL", nil)
+}
+
+// IsNotNull adds column IS NOT NULL.
+func (w *WhereBuilder) IsNotNull(column string) *WhereBuilder {
+	return w.add(column, "IS NOT NULL", nil)
+}
+
+// Or adds a term matching any of alternatives. Each alternative may be any
+// WHERE form, including another *WhereBuilder.
+func (w *WhereBuilder) Or(alternatives ...interface{}) *WhereBuilder {
+	return w.Where(Or(alternatives...))
+}
+
+// Build renders the conditions joined with AND, without the WHERE keyword.
+// The clause is empty when no conditions were added.
+func (w *WhereBuilder) Build() (string, []interface{}, error) {
+	return whereExpr(w)
+}
+
+func (w *WhereBuilder) sql() (string, []interface{}, error) {
+	return And(w.list()...).sql()
+}
+
+// list returns the builder's conditions, allowing for a nil builder.
+func (w *WhereBuilder) list() []interface{} {
+	if w == nil {
+		return nil
+	}
+	return w.conds
+}
@@ -0,0 +1,76 @@
+package mysqlutils
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+// testUUID stands in for UUID types such as uuid.UUID, a byte array that
+// implements driver.Valuer.
+type testUUID [16]byte
+
+func (u testUUID) Value() (driver.Value, error) { return u[:], nil }
+
+// testIDs is a slice type that binds as one value through driver.Valuer.
+type testIDs []int
+
+func (ids testIDs) Value() (driver.Value, error) { return json.Marshal([]int(ids)) }
+
+func TestByteValuesAreScalars(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"[]byte", []byte("abc")},
+		{"json.RawMessage", json.RawMessage(`{"a":1}`)},
+		{"net.IP", net.ParseIP("10.0.0.1")},
+		{"byte array", [4]byte{1, 2, 3, 4}},
+		{"valuer array", testUUID{1}},
+		{"valuer slice", testIDs{1, 2}},
+	}
+	for _, tt := range tests {
+		clause, args, err := buildWhere(map[string]interface{}{"doc": tt.value})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if want := " WHERE `doc` = ?"; clause != want {
+			t.Errorf("%s: clause = %q, want %q", tt.name, clause, want)
+		}
+		if len(args) != 1 {
+			t.Errorf("%s: got %d args, want 1", tt.name, len(args))
+		}
+	}
+}
+
+func TestSliceValuesExpandToIn(t *testing.T) {
+	clause, args, err := buildWhere(map[string]interface{}{"id": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " WHERE `id` IN (?, ?, ?)"; clause != want {
+		t.Errorf("clause = %q, want %q", clause, want)
+	}
+	if len(args) != 3 {
+		t.Errorf("got %d args, want 3", len(args))
+	}
+}
+
+func TestRawCondIgnoresQuotedPlaceholders(t *testing.T) {
+	for _, tt := range []struct {
+		expr string
+		args []interface{}
+	}{
+		{"note <> '?'", nil},
+		{"note <> \"?\" AND id = ?", []interface{}{1}},
+		{"`a?` = ? /* why? */", []interface{}{1}},
+	} {
+		if _, _, err := RawCond(tt.expr, tt.args...).(rawCond).sql(); err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+		}
+	}
+	if _, _, err := RawCond("note <> '?' AND id = ?").(rawCond).sql(); err == nil {
+		t.Error("missing arg: want an error")
+	}
+}